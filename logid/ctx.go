@@ -0,0 +1,32 @@
+package logid
+
+import (
+	"context"
+	"strconv"
+)
+
+// CtxLogIDKey is the context key of the logid, which is printed by github.com/erickxeno/clib/logs
+// through its legacy context extractor. The package keeps the string key to stay free of the logs module,
+// so a logid set by logs.CtxWithLogID under its typed key is not detected by NewCtx.
+const CtxLogIDKey = "K_LOGID"
+
+// NewCtx returns a copy of the context with a logid generated by GetID under CtxLogIDKey,
+// or the context itself if it already has a non-empty logid under the key.
+func NewCtx(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if logID, ok := ctx.Value(CtxLogIDKey).(string); ok && logID != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, CtxLogIDKey, String(GetID()))
+}
+
+// String formats the ID as 16 lower-case hex digits, e.g. "9a3b010f2e7c0001".
+func String(id uint64) string {
+	s := strconv.FormatUint(id, 16)
+	if len(s) < 16 {
+		s = "0000000000000000"[len(s):] + s
+	}
+	return s
+}
@@ -0,0 +1,22 @@
+package logid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCtx(t *testing.T) {
+	ctx := NewCtx(context.Background())
+	logID, ok := ctx.Value(CtxLogIDKey).(string)
+	assert.True(t, ok)
+	assert.Regexp(t, `^[0-9a-f]{16}$`, logID)
+
+	// the existing logid is kept
+	assert.Equal(t, ctx, NewCtx(ctx))
+	assert.NotEqual(t, logID, NewCtx(context.Background()).Value(CtxLogIDKey))
+
+	assert.Equal(t, "000000000000002a", String(42))
+	assert.Equal(t, "ffffffffffffffff", String(^uint64(0)))
+}
@@ -0,0 +1,332 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	osTime "time"
+)
+
+// DefaultLoggerName is the name of the default logger V1 in the logger registry.
+const DefaultLoggerName = "default"
+
+var loggerRegistry = struct {
+	sync.RWMutex
+	loggers map[string]*CLogger
+}{loggers: make(map[string]*CLogger)}
+
+// RegisterLogger registers the logger with the name, so that its levels can be changed by AdminHandler.
+// The default logger is registered as DefaultLoggerName.
+func RegisterLogger(name string, logger *CLogger) {
+	loggerRegistry.Lock()
+	defer loggerRegistry.Unlock()
+	loggerRegistry.loggers[name] = logger
+}
+
+// UnregisterLogger removes the logger from the logger registry.
+func UnregisterLogger(name string) {
+	loggerRegistry.Lock()
+	defer loggerRegistry.Unlock()
+	delete(loggerRegistry.loggers, name)
+}
+
+func getRegisteredLogger(name string) *CLogger {
+	loggerRegistry.RLock()
+	defer loggerRegistry.RUnlock()
+	return loggerRegistry.loggers[name]
+}
+
+func registeredLoggerNames() []string {
+	loggerRegistry.RLock()
+	defer loggerRegistry.RUnlock()
+	names := make([]string, 0, len(loggerRegistry.loggers))
+	for name := range loggerRegistry.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoggerStatus is the levels of a registered logger.
+// Override is set if the logger has a temporary level.
+type LoggerStatus struct {
+	Name     string          `json:"name"`
+	Level    string          `json:"level"`
+	Override *OverrideStatus `json:"override,omitempty"`
+	Writers  []WriterStatus  `json:"writers"`
+}
+
+// WriterStatus is the level of a writer, Override is set if there is a temporary level.
+type WriterStatus struct {
+	Index    int             `json:"index"`
+	Type     string          `json:"type"`
+	Level    string          `json:"level"`
+	Override *OverrideStatus `json:"override,omitempty"`
+}
+
+// OverrideStatus is a temporary level which will be reverted to Previous at ExpiresAt.
+type OverrideStatus struct {
+	Previous  string      `json:"previous"`
+	ExpiresAt osTime.Time `json:"expires_at"`
+}
+
+// LevelRequest is the body of the PUT requests,
+// TTL is a duration like "10m", the level is reverted after TTL if it is set.
+type LevelRequest struct {
+	Level string `json:"level"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+type overrideKey struct {
+	logger string
+	writer int // -1 is the logger itself
+}
+
+type levelOverride struct {
+	previous  Level
+	expiresAt osTime.Time
+	timer     *osTime.Timer
+	// loggerPrevious is the logger level before the writer is lowered, and loggerLevel is the one after,
+	// the logger level is reverted as well unless it is changed since.
+	loggerPrevious Level
+	loggerLevel    Level
+}
+
+// AdminHandler is an http.Handler to view and change the levels of the registered loggers at runtime.
+// Mount it with the prefix stripped, e.g.
+//
+//	mux.Handle("/debug/logs/", http.StripPrefix("/debug/logs", logs.NewAdminHandler()))
+//
+// It serves the following APIs:
+//
+//	GET /loggers                        lists all the registered loggers
+//	GET /loggers/{name}                 gets the levels of a logger and its writers
+//	PUT /loggers/{name}                 sets the level of a logger, see CLogger.SetLevel
+//	GET /loggers/{name}/writers/{index} gets the level of a writer
+//	PUT /loggers/{name}/writers/{index} sets the level of a writer, see CLogger.SetLevelForWriters
+//
+// The body of PUT is a LevelRequest, e.g. {"level": "debug", "ttl": "10m"}.
+// The levels of the writers still apply after the level of a logger is changed, e.g. a Warn writer never gets Debug logs.
+// Lowering a writer lowers the logger level as well if it is higher, which is reverted with the writer level
+// when the TTL expires unless the logger level is changed since.
+// Every change is logged as an audit line by the audit logger.
+type AdminHandler struct {
+	lock        sync.Mutex
+	overrides   map[overrideKey]*levelOverride
+	auditLogger *CLogger
+}
+
+// AdminOption configures AdminHandler.
+type AdminOption func(h *AdminHandler)
+
+// SetAdminAuditLogger sets the logger printing the audit lines, the default logger V1 is used by default.
+func SetAdminAuditLogger(logger *CLogger) AdminOption {
+	return func(h *AdminHandler) {
+		h.auditLogger = logger
+	}
+}
+
+// NewAdminHandler creates an AdminHandler.
+func NewAdminHandler(options ...AdminOption) *AdminHandler {
+	h := &AdminHandler{
+		overrides: make(map[overrideKey]*levelOverride),
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] == "" {
+		parts = []string{"loggers"}
+	}
+	if parts[0] != "loggers" || len(parts) == 3 || len(parts) > 4 || (len(parts) == 4 && parts[2] != "writers") {
+		writeAdminError(w, http.StatusNotFound, "unknown path: %s", r.URL.Path)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeAdminError(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+			return
+		}
+		names := registeredLoggerNames()
+		res := make([]LoggerStatus, 0, len(names))
+		for _, name := range names {
+			if logger := getRegisteredLogger(name); logger != nil {
+				res = append(res, h.loggerStatus(name, logger))
+			}
+		}
+		writeAdminJSON(w, res)
+		return
+	}
+
+	name := parts[1]
+	logger := getRegisteredLogger(name)
+	if logger == nil {
+		writeAdminError(w, http.StatusNotFound, "unknown logger: %s", name)
+		return
+	}
+	writerIndex := -1
+	if len(parts) == 4 {
+		index, err := strconv.Atoi(parts[3])
+		if err != nil || index < 0 || index >= len(logger.writers) {
+			writeAdminError(w, http.StatusNotFound, "unknown writer %s of logger %s", parts[3], name)
+			return
+		}
+		writerIndex = index
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req LevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid body: %s", err)
+			return
+		}
+		level, err := ParseLevel(req.Level)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+		var ttl osTime.Duration
+		if req.TTL != "" {
+			ttl, err = osTime.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 {
+				writeAdminError(w, http.StatusBadRequest, "invalid ttl: %q", req.TTL)
+				return
+			}
+		}
+		h.setLevel(name, logger, writerIndex, level, ttl, r.RemoteAddr)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+		return
+	}
+
+	status := h.loggerStatus(name, logger)
+	if writerIndex >= 0 {
+		writeAdminJSON(w, status.Writers[writerIndex])
+		return
+	}
+	writeAdminJSON(w, status)
+}
+
+// setLevel sets the level of the logger if writerIndex is -1, otherwise the level of the writer.
+func (h *AdminHandler) setLevel(name string, logger *CLogger, writerIndex int, level Level, ttl osTime.Duration, operator string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := overrideKey{logger: name, writer: writerIndex}
+	current := getAdminLevel(logger, writerIndex)
+	previous, loggerPrevious := current, logger.GetLevel()
+	if override, overridden := h.overrides[key]; overridden {
+		// keep the levels before the first override, so that they are reverted to the original levels.
+		override.timer.Stop()
+		delete(h.overrides, key)
+		previous, loggerPrevious = override.previous, override.loggerPrevious
+	}
+	h.audit(name, writerIndex, current, level, ttl, operator)
+	setAdminLevel(logger, writerIndex, level)
+	if ttl > 0 {
+		override := &levelOverride{
+			previous:       previous,
+			expiresAt:      osTime.Now().Add(ttl),
+			loggerPrevious: loggerPrevious,
+			loggerLevel:    logger.GetLevel(),
+		}
+		override.timer = osTime.AfterFunc(ttl, func() { h.revert(key, override, logger) })
+		h.overrides[key] = override
+	}
+}
+
+func (h *AdminHandler) revert(key overrideKey, override *levelOverride, logger *CLogger) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.overrides[key] != override {
+		// it has been replaced by another change
+		return
+	}
+	delete(h.overrides, key)
+	h.audit(key.logger, key.writer, getAdminLevel(logger, key.writer), override.previous, 0, "ttl expired")
+	setAdminLevel(logger, key.writer, override.previous)
+	if key.writer >= 0 && logger.GetLevel() == override.loggerLevel {
+		logger.SetLevel(override.loggerPrevious)
+	}
+}
+
+func getAdminLevel(logger *CLogger, writerIndex int) Level {
+	if writerIndex < 0 {
+		return logger.GetLevel()
+	}
+	return logger.writers[writerIndex].getLevel()
+}
+
+func setAdminLevel(logger *CLogger, writerIndex int, level Level) {
+	if writerIndex < 0 {
+		logger.SetLevel(level)
+		return
+	}
+	logger.SetLevelForWriters(level, logger.writers[writerIndex].LogWriter)
+}
+
+func (h *AdminHandler) audit(name string, writerIndex int, from, to Level, ttl osTime.Duration, operator string) {
+	auditLogger := h.auditLogger
+	if auditLogger == nil {
+		auditLogger = V1
+	}
+	if auditLogger == nil {
+		return
+	}
+	auditLogger.Warn().Str("log level changed").
+		KVs("logger", name, "writer", writerIndex, "from", from.String(), "to", to.String(), "ttl", ttl.String(), "operator", operator).
+		Emit()
+}
+
+func (h *AdminHandler) loggerStatus(name string, logger *CLogger) LoggerStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	status := LoggerStatus{
+		Name:    name,
+		Level:   logger.GetLevel().String(),
+		Writers: make([]WriterStatus, 0, len(logger.writers)),
+	}
+	if override, ok := h.overrides[overrideKey{logger: name, writer: -1}]; ok {
+		status.Override = &OverrideStatus{
+			Previous:  override.previous.String(),
+			ExpiresAt: override.expiresAt,
+		}
+	}
+	for i := range logger.writers {
+		writerStatus := WriterStatus{
+			Index: i,
+			Type:  fmt.Sprintf("%T", logger.writers[i].LogWriter),
+			Level: logger.writers[i].getLevel().String(),
+		}
+		if override, ok := h.overrides[overrideKey{logger: name, writer: i}]; ok {
+			writerStatus.Override = &OverrideStatus{
+				Previous:  override.previous.String(),
+				ExpiresAt: override.expiresAt,
+			}
+		}
+		status.Writers = append(status.Writers, writerStatus)
+	}
+	return status
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf(format, args...)})
+}
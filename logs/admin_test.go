@@ -0,0 +1,170 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+
+	w "github.com/erickxeno/clib/logs/writer"
+)
+
+func newAdminTestServer(t *testing.T) (*httptest.Server, *CLogger, *contentRecorder) {
+	audit := &contentRecorder{}
+	warnWriter := &contentRecorder{}
+	logger := NewCLogger(SetWriter(InfoLevel, &w.NoopWriter{}, warnWriter))
+	logger.SetLevelForWriters(WarnLevel, warnWriter)
+	RegisterLogger("admin_test", logger)
+	t.Cleanup(func() { UnregisterLogger("admin_test") })
+
+	auditLogger := NewCLogger(SetWriter(TraceLevel, audit))
+	server := httptest.NewServer(http.StripPrefix("/debug/logs", NewAdminHandler(SetAdminAuditLogger(auditLogger))))
+	t.Cleanup(server.Close)
+	return server, logger, audit
+}
+
+func adminRequest(t *testing.T, method, url, body string, res interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	if res != nil {
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(res))
+	}
+	return resp.StatusCode
+}
+
+func TestAdminHandler_Get(t *testing.T) {
+	server, _, _ := newAdminTestServer(t)
+
+	var loggers []LoggerStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, server.URL+"/debug/logs/loggers", "", &loggers))
+	var found bool
+	for _, status := range loggers {
+		if status.Name == "admin_test" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	var status LoggerStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, server.URL+"/debug/logs/loggers/admin_test", "", &status))
+	assert.Equal(t, "Info", status.Level)
+	assert.Equal(t, 2, len(status.Writers))
+	assert.Equal(t, "*writer.NoopWriter", status.Writers[0].Type)
+	assert.Equal(t, "Warn", status.Writers[1].Level)
+
+	var writerStatus WriterStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, server.URL+"/debug/logs/loggers/admin_test/writers/1", "", &writerStatus))
+	assert.Equal(t, 1, writerStatus.Index)
+	assert.Equal(t, "Warn", writerStatus.Level)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodGet, server.URL+"/debug/logs/loggers/unknown", "", nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodGet, server.URL+"/debug/logs/loggers/admin_test/writers/2", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, adminRequest(t, http.MethodPost, server.URL+"/debug/logs/loggers/admin_test", "", nil))
+}
+
+func TestAdminHandler_Put(t *testing.T) {
+	server, logger, audit := newAdminTestServer(t)
+	url := server.URL + "/debug/logs/loggers/admin_test"
+
+	// the logger level is changed only, the Warn writer keeps its level
+	var status LoggerStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "debug"}`, &status))
+	assert.Equal(t, "Debug", status.Level)
+	assert.Equal(t, "Info", status.Writers[0].Level)
+	assert.Equal(t, "Warn", status.Writers[1].Level)
+	assert.Equal(t, DebugLevel, logger.GetLevel())
+	assert.Equal(t, 1, len(audit.contents))
+	assert.Contains(t, audit.last(), "log level changed")
+	assert.Contains(t, audit.last(), "from=Info")
+	assert.Contains(t, audit.last(), "to=Debug")
+
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "ERROR"}`, &status))
+	assert.Equal(t, ErrorLevel, logger.GetLevel())
+
+	// raising a writer keeps the logger level set by the operator
+	var writerStatus WriterStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url+"/writers/1", `{"level": "fatal"}`, &writerStatus))
+	assert.Equal(t, "Fatal", writerStatus.Level)
+	assert.Equal(t, ErrorLevel, logger.GetLevel())
+	assert.Equal(t, InfoLevel, logger.writers[0].getLevel())
+
+	// lowering a writer lowers the logger level as well like SetLevelForWriters
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url+"/writers/0", `{"level": "debug"}`, &writerStatus))
+	assert.Equal(t, "Debug", writerStatus.Level)
+	assert.Equal(t, DebugLevel, logger.GetLevel())
+
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, http.MethodPut, url, `{"level": "verbose"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, http.MethodPut, url, `{"level": "info", "ttl": "soon"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, http.MethodPut, url, `level=info`, nil))
+}
+
+func TestAdminHandler_TTL(t *testing.T) {
+	server, logger, audit := newAdminTestServer(t)
+	url := server.URL + "/debug/logs/loggers/admin_test/writers/1"
+
+	var writerStatus WriterStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "trace", "ttl": "200ms"}`, &writerStatus))
+	assert.Equal(t, "Trace", writerStatus.Level)
+	assert.NotNil(t, writerStatus.Override)
+	assert.Equal(t, "Warn", writerStatus.Override.Previous)
+	assert.Equal(t, TraceLevel, logger.GetLevel())
+
+	// another override keeps the original level
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "debug", "ttl": "200ms"}`, &writerStatus))
+	assert.Equal(t, "Warn", writerStatus.Override.Previous)
+
+	assert.Eventually(t, func() bool {
+		return logger.GetLevel() == InfoLevel
+	}, 2*osTime.Second, 10*osTime.Millisecond)
+	var reverted WriterStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url, "", &reverted))
+	assert.Equal(t, "Warn", reverted.Level)
+	assert.Nil(t, reverted.Override)
+	assert.Contains(t, audit.last(), "operator=ttl expired")
+
+	// a permanent change cancels the override
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "debug", "ttl": "100ms"}`, &writerStatus))
+	var permanent WriterStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "notice"}`, &permanent))
+	assert.Nil(t, permanent.Override)
+	osTime.Sleep(200 * osTime.Millisecond)
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url, "", &writerStatus))
+	assert.Equal(t, "Notice", writerStatus.Level)
+}
+
+func TestAdminHandler_LoggerTTL(t *testing.T) {
+	server, logger, _ := newAdminTestServer(t)
+	url := server.URL + "/debug/logs/loggers/admin_test"
+
+	var status LoggerStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodPut, url, `{"level": "error", "ttl": "100ms"}`, &status))
+	assert.Equal(t, "Error", status.Level)
+	assert.NotNil(t, status.Override)
+	assert.Equal(t, "Info", status.Override.Previous)
+	assert.Equal(t, "Warn", status.Writers[1].Level)
+
+	assert.Eventually(t, func() bool {
+		return logger.GetLevel() == InfoLevel
+	}, 2*osTime.Second, 10*osTime.Millisecond)
+	var reverted LoggerStatus
+	assert.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url, "", &reverted))
+	assert.Nil(t, reverted.Override)
+	assert.Equal(t, "Warn", reverted.Writers[1].Level)
+}
+
+func TestParseLevel(t *testing.T) {
+	for level := TraceLevel; level <= FatalLevel; level++ {
+		parsed, err := ParseLevel(strings.ToUpper(level.String()))
+		assert.Nil(t, err)
+		assert.Equal(t, level, parsed)
+	}
+	_, err := ParseLevel("verbose")
+	assert.NotNil(t, err)
+}
@@ -383,3 +383,15 @@ func BenchmarkNoopWriter_WithRateLimit(b *testing.B) {
 
 	})
 }
+
+func BenchmarkRedactMiddleware(b *testing.B) {
+	logger := NewCLogger(SetWriter(TraceLevel, &w.NoopWriter{}), SetRedaction(
+		RedactKeys(RedactFull, "password", "token"),
+		RedactCnMobile(RedactKeepLast4),
+	))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info().Str("user login", "success").KV("user", "alice").KV("count", i).Emit()
+	}
+}
@@ -2,6 +2,8 @@ package logs
 
 import (
 	"context"
+	"path/filepath"
+	"strconv"
 	"unsafe"
 )
 
@@ -34,6 +36,15 @@ func (l *CLogger) GetOptions() []Option {
 	return l.options
 }
 
+// FormatLocation formats the file and line as the location printed by the logger,
+// the full path is kept if SetFullPath or the security mark is enabled, otherwise only the base name.
+func (l *CLogger) FormatLocation(file string, line int) string {
+	if !(l.fullPath || enableSecMark) {
+		file = filepath.Base(file)
+	}
+	return file + ":" + strconv.Itoa(line)
+}
+
 func (l *CLogger) prefix(log *Log) *Log {
 	return (*prefixedLog)(unsafe.Pointer(log)).Level().Time().Version().Location().Host().PSM(l.psm).LogID().Cluster().Stage().SpanID().End()
 }
@@ -161,13 +161,25 @@ func CtxStackInfo(ctx context.Context, stackInfo StackInfo) context.Context {
 	return context.WithValue(ctx, stackInfoCtxKey, stackInfo)
 }
 
+// CtxWithLogID returns a copy of the context with the logid, which is printed in the prefix of the logs.
+// It takes precedence over the legacy "K_LOGID" key.
+func CtxWithLogID(ctx context.Context, logID string) context.Context {
+	return writer.ContextWithLogID(ctx, logID)
+}
+
+// CtxWithSpanID returns a copy of the context with the spanid, which is printed in the prefix of the logs.
+// It takes precedence over the legacy "K_SPANID" key.
+func CtxWithSpanID(ctx context.Context, spanID uint64) context.Context {
+	return writer.ContextWithSpanID(ctx, spanID)
+}
+
+// LogIDFromCtx returns the logid of the context found by the context extractors, or "" if there is none.
+func LogIDFromCtx(ctx context.Context) string {
+	return writer.ExtractContext(ctx).LogID
+}
+
 func logIDFromContext(ctx context.Context) string {
-	if ctx == nil {
-		return "-"
-	}
-	val := ctx.Value(logIDCtxKey)
-	if val != nil {
-		logID := val.(string)
+	if logID := writer.ExtractContext(ctx).LogID; logID != "" {
 		return logID
 	}
 	return "-"
@@ -183,15 +195,5 @@ Transaction(后续简称Txn): Trace的组成单元，记录Trace在单个服务
 	Txn不用使用方显式地创建和关闭，而是由SDK自动将同一个请求上下文中的Span/Event/Metric对象打包在一个Txn中
 */
 func spanIDFromContext(ctx context.Context) uint64 {
-	if ctx == nil {
-		return 0
-	}
-	val := ctx.Value(spanIDCtxKey)
-	if val != nil {
-		spanID, valid := val.(uint64)
-		if valid {
-			return spanID
-		}
-	}
-	return 0
+	return writer.ExtractContext(ctx).SpanID
 }
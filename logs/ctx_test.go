@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	w "github.com/erickxeno/clib/logs/writer"
 )
 
@@ -20,3 +22,44 @@ func TestCtxAddKVs(t *testing.T) {
 	V1.CtxInfo(ctx, "hel%s", "lo world")
 
 }
+
+type tenantCtxKey struct{}
+
+func TestContextExtractor(t *testing.T) {
+	w.RegisterContextExtractor("tenant", func(ctx context.Context) w.ContextFields {
+		if tenant, ok := ctx.Value(tenantCtxKey{}).(string); ok {
+			return w.ContextFields{KVs: []interface{}{"tenant", tenant}}
+		}
+		return w.ContextFields{}
+	})
+	defer w.UnregisterContextExtractor("tenant")
+
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder))
+	ctx := context.WithValue(context.Background(), w.ContextTraceparentKey, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx = context.WithValue(ctx, tenantCtxKey{}, "t-1")
+	logger.Info(WithCtx(ctx)).Str("hello").Emit()
+	assert.Regexp(t, ` 4bf92f3577b34da6a3ce929d0e0e4736 .* 67667974448284343 tenant=t-1 hello$`, recorder.last())
+
+	// the logid of an unexpected type doesn't panic
+	ctx = context.WithValue(context.Background(), logIDCtxKey, 12345)
+	assert.NotPanics(t, func() { logger.Info(WithCtx(ctx)).Str("hello").Emit() })
+	assert.Regexp(t, ` - .* 0 hello$`, recorder.last())
+}
+
+func TestCtxWithLogID(t *testing.T) {
+	assert.Equal(t, "", LogIDFromCtx(context.Background()))
+	ctx := CtxWithLogID(context.Background(), "typed-logid")
+	ctx = CtxWithSpanID(ctx, 42)
+	assert.Equal(t, "typed-logid", LogIDFromCtx(ctx))
+
+	// the typed keys take precedence over the legacy ones
+	legacy := context.WithValue(ctx, logIDCtxKey, "legacy-logid")
+	assert.Equal(t, "typed-logid", LogIDFromCtx(legacy))
+	assert.Equal(t, "legacy-logid", LogIDFromCtx(context.WithValue(context.Background(), logIDCtxKey, "legacy-logid")))
+
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder))
+	logger.Info(WithCtx(legacy)).Str("hello").Emit()
+	assert.Regexp(t, ` typed-logid .* 42 hello$`, recorder.last())
+}
@@ -51,6 +51,7 @@ func Init() {
 	ops = append(ops, SetWriter(level, writers...))
 	V1 = NewCLogger(ops...)
 	defaultLogger = NewCompatLoggerFrom(V1, WithCallDepthOffset(2))
+	RegisterLogger(DefaultLoggerName, V1)
 }
 
 // SetDefaultLogger resets the default logger with specified options,
@@ -64,6 +65,22 @@ func SetDefaultLogger(ops ...Option) {
 	*defaultLogger = *NewCompatLoggerFrom(V1, WithCallDepthOffset(2))
 }
 
+// ReplaceDefaultLogger replaces the default logger with a new one created by the options,
+// and returns a function to restore the previous one. It is not thread-safe and is mainly used in tests.
+func ReplaceDefaultLogger(ops ...Option) (restore func()) {
+	if V1 == nil {
+		V1 = NewCLogger()
+		defaultLogger = NewCompatLoggerFrom(V1, WithCallDepthOffset(2))
+	}
+	prevV1, prevDefaultLogger := *V1, *defaultLogger
+	*V1 = *NewCLogger(ops...)
+	*defaultLogger = *NewCompatLoggerFrom(V1, WithCallDepthOffset(2))
+	return func() {
+		*V1 = prevV1
+		*defaultLogger = prevDefaultLogger
+	}
+}
+
 // SetLevel sets the minimal level for defaultLogger. It is safe to increase the level.
 // Please not decrease the level directly. Use SetLevelForWriters instead.
 func SetLevel(newLevel Level) {
@@ -73,6 +90,15 @@ func SetLevel(newLevel Level) {
 	defaultLogger.v1.SetLevel(newLevel)
 }
 
+// SetVModule sets the per-file or per-package levels of the defaultLogger at runtime,
+// e.g. "storage/*.go=debug,github.com/foo/bar/...=warn".
+func SetVModule(spec string) error {
+	if defaultLogger == nil {
+		return nil
+	}
+	return defaultLogger.v1.SetVModule(spec)
+}
+
 // SetLevelForWriters updates the minimal level for the writer of the defaultLogger.
 // It may also update the loggers' level.
 func SetLevelForWriters(newLevel Level, logWriters ...writer.LogWriter) {
@@ -0,0 +1,51 @@
+// agent_receiver is a reference log agent which prints the logs sent by writer.AgentWriter.
+//
+//	go run ./example/agent_receiver -socket /tmp/log_agent.sock
+//
+// and set the writer with writer.NewAgentWriter(writer.SetAgentSocketPath("/tmp/log_agent.sock")).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/erickxeno/clib/logs/writer"
+)
+
+func main() {
+	socketPath := flag.String("socket", writer.DefaultAgentSocketPath, "unix domain socket path to listen")
+	flag.Parse()
+
+	receiver, err := writer.NewAgentReceiver(*socketPath, printRecords)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "listen %s error: %s\n", *socketPath, err)
+		os.Exit(1)
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		_ = receiver.Close()
+	}()
+	if err := receiver.Serve(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "serve error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func printRecords(records []*writer.AgentRecord) {
+	var sb strings.Builder
+	for _, r := range records {
+		sb.Reset()
+		_, _ = fmt.Fprintf(&sb, "%s %s %s %s %s %d %s", r.Level, r.Time.Format("2006-01-02 15:04:05.000"), r.Location, r.PSM, r.LogID, r.SpanID, r.Message)
+		for _, kv := range r.KVs {
+			sb.WriteByte(' ')
+			sb.WriteString(kv.String())
+		}
+		fmt.Println(sb.String())
+	}
+}
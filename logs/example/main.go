@@ -20,7 +20,7 @@ type foo struct {
 
 func main() {
 	ctx := context.TODO()
-	ctx = context.WithValue(ctx, "K_LOGID", "1111")
+	ctx = logs.CtxWithLogID(ctx, "1111")
 	foo := &foo{"bar", 0}
 	err := fmt.Errorf("an error")
 	log.V1.Info().
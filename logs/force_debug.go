@@ -0,0 +1,143 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	osTime "time"
+)
+
+type forceDebugEntry struct {
+	level     Level
+	expiresAt osTime.Time
+	timer     *osTime.Timer
+}
+
+// forceDebugRegistry holds the logids and ctx KVs whose logs are forced to be printed at a lower level.
+type forceDebugRegistry struct {
+	lock   sync.RWMutex
+	count  int32 // the number of entries, it is checked first so that there is no cost if it is empty
+	logIDs map[string]*forceDebugEntry
+	kvs    map[string]map[string]*forceDebugEntry // key -> value -> entry
+}
+
+var forceDebug = &forceDebugRegistry{
+	logIDs: make(map[string]*forceDebugEntry),
+	kvs:    make(map[string]map[string]*forceDebugEntry),
+}
+
+// ForceDebugLogID prints the logs of the logid at the level for the next ttl,
+// e.g. ForceDebugLogID(logID, DebugLevel, 10*time.Minute).
+// Like the dynamic level, the logs are written to all the writers regardless of their levels.
+// It works when the logs are printed with the context, e.g. logger.Debug(WithCtx(ctx)).
+func ForceDebugLogID(logID string, level Level, ttl osTime.Duration) {
+	forceDebug.add(logID, "", level, ttl, true)
+}
+
+// ForceDebugKV prints the logs whose ctx KVs (see CtxAddKVs) contain the key-value at the level for the next ttl,
+// e.g. ForceDebugKV("uid", 10086, DebugLevel, 10*time.Minute). The values are compared in string format.
+func ForceDebugKV(key string, value interface{}, level Level, ttl osTime.Duration) {
+	forceDebug.add(key, fmt.Sprint(value), level, ttl, false)
+}
+
+// CancelForceDebugLogID removes the logid added by ForceDebugLogID.
+func CancelForceDebugLogID(logID string) {
+	forceDebug.remove(logID, "", nil, true)
+}
+
+// CancelForceDebugKV removes the key-value added by ForceDebugKV.
+func CancelForceDebugKV(key string, value interface{}) {
+	forceDebug.remove(key, fmt.Sprint(value), nil, false)
+}
+
+func (r *forceDebugRegistry) add(key, value string, level Level, ttl osTime.Duration, isLogID bool) {
+	if ttl <= 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry := &forceDebugEntry{level: level, expiresAt: osTime.Now().Add(ttl)}
+	entry.timer = osTime.AfterFunc(ttl, func() { r.remove(key, value, entry, isLogID) })
+	var old *forceDebugEntry
+	if isLogID {
+		old = r.logIDs[key]
+		r.logIDs[key] = entry
+	} else {
+		values := r.kvs[key]
+		if values == nil {
+			values = make(map[string]*forceDebugEntry)
+			r.kvs[key] = values
+		}
+		old = values[value]
+		values[value] = entry
+	}
+	if old != nil {
+		old.timer.Stop()
+	} else {
+		atomic.AddInt32(&r.count, 1)
+	}
+}
+
+// remove removes the entry of the key, if entry is not nil, it is removed only if it is not replaced.
+func (r *forceDebugRegistry) remove(key, value string, entry *forceDebugEntry, isLogID bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var old *forceDebugEntry
+	if isLogID {
+		old = r.logIDs[key]
+		if old == nil || (entry != nil && old != entry) {
+			return
+		}
+		delete(r.logIDs, key)
+	} else {
+		old = r.kvs[key][value]
+		if old == nil || (entry != nil && old != entry) {
+			return
+		}
+		delete(r.kvs[key], value)
+		if len(r.kvs[key]) == 0 {
+			delete(r.kvs, key)
+		}
+	}
+	old.timer.Stop()
+	atomic.AddInt32(&r.count, -1)
+}
+
+// level returns the lowest forced level of the logid and ctx KVs in the context.
+func (r *forceDebugRegistry) level(ctx context.Context) (Level, bool) {
+	if atomic.LoadInt32(&r.count) == 0 || ctx == nil {
+		return 0, false
+	}
+	now := osTime.Now()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	level, found := FatalLevel, false
+	check := func(entry *forceDebugEntry) {
+		if entry != nil && entry.level <= level && now.Before(entry.expiresAt) {
+			level, found = entry.level, true
+		}
+	}
+	if len(r.logIDs) > 0 {
+		if logID := logIDFromContext(ctx); logID != "-" {
+			check(r.logIDs[logID])
+		}
+	}
+	if len(r.kvs) > 0 {
+		for kvs := getKVs(ctx); kvs != nil; kvs = kvs.pre {
+			for i := 0; i+1 < len(kvs.kvs); i += 2 {
+				key, ok := kvs.kvs[i].(string)
+				if !ok {
+					continue
+				}
+				if values := r.kvs[key]; values != nil {
+					check(values[fmt.Sprint(kvs.kvs[i+1])])
+				}
+			}
+		}
+	}
+	return level, found
+}
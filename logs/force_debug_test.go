@@ -0,0 +1,84 @@
+package logs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceDebug_LogID(t *testing.T) {
+	infoWriter, warnWriter := &contentRecorder{}, &contentRecorder{}
+	logger := NewCLogger(SetWriter(InfoLevel, infoWriter, warnWriter))
+	logger.SetLevelForWriters(WarnLevel, warnWriter)
+
+	ctx := context.WithValue(context.Background(), logIDCtxKey, "force_debug_logid")
+	other := context.WithValue(context.Background(), logIDCtxKey, "other_logid")
+
+	logger.Debug(WithCtx(ctx)).Str("before").Emit()
+	assert.Equal(t, 0, len(infoWriter.contents))
+
+	ForceDebugLogID("force_debug_logid", DebugLevel, 200*osTime.Millisecond)
+	logger.Debug(WithCtx(ctx)).Str("debug").Emit()
+	logger.Trace(WithCtx(ctx)).Str("trace").Emit()
+	logger.Debug(WithCtx(other)).Str("other").Emit()
+	logger.Debug().Str("no ctx").Emit()
+	assert.Equal(t, 1, len(infoWriter.contents))
+	assert.Contains(t, infoWriter.last(), "debug")
+	// all the writers get the logs
+	assert.Equal(t, 1, len(warnWriter.contents))
+
+	// it expires on its own
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&forceDebug.count) == 0
+	}, 2*osTime.Second, 10*osTime.Millisecond)
+	logger.Debug(WithCtx(ctx)).Str("expired").Emit()
+	assert.Equal(t, 1, len(infoWriter.contents))
+
+	ForceDebugLogID("force_debug_logid", TraceLevel, osTime.Minute)
+	logger.Trace(WithCtx(ctx)).Str("trace").Emit()
+	assert.Equal(t, 2, len(infoWriter.contents))
+	CancelForceDebugLogID("force_debug_logid")
+	logger.Trace(WithCtx(ctx)).Str("trace").Emit()
+	assert.Equal(t, 2, len(infoWriter.contents))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&forceDebug.count))
+}
+
+func TestForceDebug_KV(t *testing.T) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(InfoLevel, recorder))
+
+	ForceDebugKV("uid", 10086, DebugLevel, osTime.Minute)
+	defer CancelForceDebugKV("uid", 10086)
+
+	ctx := CtxAddKVs(context.Background(), "uid", int64(10086))
+	ctx = CtxAddKVs(ctx, "city", "beijing")
+	logger.Debug(WithCtx(ctx)).Str("debug").Emit()
+	assert.Equal(t, 1, len(recorder.contents))
+
+	logger.Debug(WithCtx(CtxAddKVs(context.Background(), "uid", "10010"))).Str("other").Emit()
+	assert.Equal(t, 1, len(recorder.contents))
+
+	// the dynamic level in the context goes first
+	logger.Debug(WithCtx(context.WithValue(ctx, DynamicLogLevelKey, InfoLevel))).Str("debug").Emit()
+	assert.Equal(t, 1, len(recorder.contents))
+
+	// the compatible logger with dynamic level
+	compat := NewCompatLoggerFrom(logger, WithDynamicLevel(true))
+	compat.CtxDebug(ctx, "compat %s", "debug")
+	assert.Equal(t, 2, len(recorder.contents))
+	assert.Contains(t, recorder.last(), "compat debug")
+}
+
+func BenchmarkForceDebug_Miss(b *testing.B) {
+	ForceDebugLogID("benchmark_logid", DebugLevel, osTime.Minute)
+	defer CancelForceDebugLogID("benchmark_logid")
+	ctx := context.WithValue(context.Background(), logIDCtxKey, "other_logid")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		forceDebug.level(ctx)
+	}
+}
@@ -0,0 +1,273 @@
+// Package httplog provides the net/http middlewares carrying the logid through the requests and printing the access logs.
+package httplog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	osTime "time"
+
+	"github.com/erickxeno/clib/logs"
+)
+
+const (
+	// DefaultLogIDHeader is the default header of the logid.
+	DefaultLogIDHeader = "X-Log-Id"
+	// DefaultSpanIDHeader is the default header of the spanid in decimal, which is the child spanid created by the caller.
+	DefaultSpanIDHeader = "X-Span-Id"
+	// LogLevelHeader is the header setting the dynamic log level of the request, e.g. "debug".
+	LogLevelHeader = "X-Log-Level"
+
+	// maxLogIDLen is the max length of the logid read from the request.
+	maxLogIDLen = 64
+)
+
+// ServerOption configures the server middleware.
+type ServerOption func(m *serverMiddleware)
+
+type serverMiddleware struct {
+	logger       *logs.CLogger
+	logIDHeader  string
+	spanIDHeader string
+	newLogID     func() string
+	trusted      func(r *http.Request) bool
+}
+
+// SetServerLogger sets the logger of the access logs and the panics, logs.V1 by default.
+func SetServerLogger(logger *logs.CLogger) ServerOption {
+	return func(m *serverMiddleware) {
+		m.logger = logger
+	}
+}
+
+// SetLogIDHeader sets the header of the logid, which is read from the request and written to the response.
+func SetLogIDHeader(header string) ServerOption {
+	return func(m *serverMiddleware) {
+		m.logIDHeader = header
+	}
+}
+
+// SetSpanIDHeader sets the header of the spanid, which is read from the request.
+func SetSpanIDHeader(header string) ServerOption {
+	return func(m *serverMiddleware) {
+		m.spanIDHeader = header
+	}
+}
+
+// SetLogIDGenerator sets the function generating the logid when the request has none or an invalid one,
+// 16 random hex digits by default.
+func SetLogIDGenerator(newLogID func() string) ServerOption {
+	return func(m *serverMiddleware) {
+		m.newLogID = newLogID
+	}
+}
+
+// SetTrustedCaller sets the function reporting whether the LogLevelHeader of the request is respected,
+// the header is ignored by default since it may flood the logs.
+func SetTrustedCaller(trusted func(r *http.Request) bool) ServerOption {
+	return func(m *serverMiddleware) {
+		m.trusted = trusted
+	}
+}
+
+// NewServerMiddleware creates a middleware which puts the logid, the spanid and a notice into the context of each request,
+// prints an access log merged with the pushed notice KVs when the request ends, and recovers the panics as Error logs.
+// The access log is built from the KVs of logs.GetNotice rather than printed by logs.CtxFlushNotice,
+// so the notice KVs follow the method, path, status, bytes and latency in a single Notice log.
+// The status of a panicked request is 500 unless the handler has written the header, and its access log has panic=true.
+// The access log of a hijacked request has hijacked=true instead of the status and the bytes, which are unknown.
+// The logid of the request is replaced by a generated one if it is longer than 64 bytes
+// or has the characters other than letters, digits, '.', '_' and '-'.
+func NewServerMiddleware(options ...ServerOption) func(http.Handler) http.Handler {
+	m := &serverMiddleware{
+		logIDHeader:  DefaultLogIDHeader,
+		spanIDHeader: DefaultSpanIDHeader,
+		newLogID:     newLogID,
+	}
+	for _, op := range options {
+		op(m)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.serve(next, w, r)
+		})
+	}
+}
+
+func (m *serverMiddleware) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	start := osTime.Now()
+	logID := r.Header.Get(m.logIDHeader)
+	if !validLogID(logID) {
+		logID = m.newLogID()
+	}
+	ctx := logs.NewNoticeCtx(logs.CtxWithLogID(r.Context(), logID))
+	if spanID, err := strconv.ParseUint(r.Header.Get(m.spanIDHeader), 10, 64); err == nil && spanID != 0 {
+		ctx = logs.CtxWithSpanID(ctx, spanID)
+	}
+	if m.trusted != nil && m.trusted(r) {
+		if level, err := logs.ParseLevel(r.Header.Get(LogLevelHeader)); err == nil {
+			ctx = context.WithValue(ctx, logs.DynamicLogLevelKey, level)
+		}
+	}
+	w.Header().Set(m.logIDHeader, logID)
+	rw := &responseWriter{ResponseWriter: w}
+
+	panicked := false
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler {
+				// the handler aborts the response deliberately
+				panic(p)
+			}
+			m.getLogger().Error(logs.WithCtx(ctx)).Str("http handler panic:").Str(fmt.Sprint(p)).
+				KV("method", r.Method).KV("path", r.URL.Path).Stack(false).Emit()
+			panicked = true
+			if !rw.wroteHeader && !rw.hijacked {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+		m.accessLog(ctx, r, rw, osTime.Since(start), panicked)
+	}()
+	next.ServeHTTP(rw.wrap(), r.WithContext(ctx))
+}
+
+func (m *serverMiddleware) accessLog(ctx context.Context, r *http.Request, rw *responseWriter, latency osTime.Duration, panicked bool) {
+	log := m.getLogger().Notice(logs.WithCtx(ctx))
+	if log == nil {
+		return
+	}
+	log.KV("method", r.Method).KV("path", r.URL.Path)
+	if rw.hijacked {
+		// the connection is taken over by the handler, what it sends is unknown
+		log.KV("hijacked", true)
+	} else {
+		status := rw.status
+		if !rw.wroteHeader {
+			status = http.StatusOK
+		}
+		log.KV("status", status).KV("bytes", rw.bytes)
+	}
+	log.KV("latency", latency.String())
+	if panicked {
+		// the status is the one sent to the client, which is not 500 if the header was written before the panic
+		log.KV("panic", true)
+	}
+	if ntc := logs.GetNotice(ctx); ntc != nil {
+		log.KVs(ntc.KVs()...)
+	}
+	log.Emit()
+}
+
+func (m *serverMiddleware) getLogger() *logs.CLogger {
+	if m.logger != nil {
+		return m.logger
+	}
+	return logs.V1
+}
+
+// validLogID reports whether the logid from the request is not empty, not too long, and only has the safe characters.
+func validLogID(logID string) bool {
+	if logID == "" || len(logID) > maxLogIDLen {
+		return false
+	}
+	for i := 0; i < len(logID); i++ {
+		c := logID[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// newLogID returns 16 random hex digits.
+func newLogID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// responseWriter records the status and the bytes of the response.
+// It is passed to the handler by wrap, which only advertises the optional interfaces of the underlying writer.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+	hijacked    bool
+}
+
+// wrap returns the writer implementing http.Flusher and http.Hijacker only if the underlying writer does,
+// the other interfaces are reachable by http.ResponseController through Unwrap.
+func (w *responseWriter) wrap() http.ResponseWriter {
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return flushHijackWriter{w}
+	case flusher:
+		return flushWriter{w}
+	case hijacker:
+		return hijackWriter{w}
+	default:
+		return w
+	}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) flush() {
+	if !w.wroteHeader {
+		// flushing sends the header with 200
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type flushWriter struct{ *responseWriter }
+
+func (w flushWriter) Flush() { w.flush() }
+
+type hijackWriter struct{ *responseWriter }
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type flushHijackWriter struct{ *responseWriter }
+
+func (w flushHijackWriter) Flush() { w.flush() }
+
+func (w flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
@@ -0,0 +1,194 @@
+package httplog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/erickxeno/clib/logs"
+	"github.com/erickxeno/clib/logs/logtest"
+)
+
+func TestServerMiddleware(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	logger.SetLevel(logs.InfoLevel)
+	handler := NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logs.CtxPushNotice(ctx, "user", "alice")
+		logger.Debug(logs.WithCtx(ctx)).Str("debug in handler").Emit()
+		logger.Info(logs.WithCtx(ctx)).Str("info in handler").Emit()
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users?id=1", nil)
+	req.Header.Set(DefaultLogIDHeader, "request-logid")
+	req.Header.Set(LogLevelHeader, "debug")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "request-logid", rec.Header().Get(DefaultLogIDHeader))
+	// the level header is ignored for untrusted callers
+	logtest.AssertNotLogged(t, o, logs.DebugLevel, "debug in handler")
+	logtest.AssertCount(t, o.All().Filter(func(e logtest.Entry) bool { return e.LogID == "request-logid" }), 2)
+
+	access := o.FilterLevel(logs.NoticeLevel)
+	logtest.AssertCount(t, access, 1)
+	logtest.AssertKV(t, access[0], "method", "POST")
+	logtest.AssertKV(t, access[0], "path", "/users")
+	logtest.AssertKV(t, access[0], "status", 201)
+	logtest.AssertKV(t, access[0], "bytes", 5)
+	logtest.AssertKV(t, access[0], "user", "alice")
+	_, ok := access[0].KV("latency")
+	assert.True(t, ok)
+}
+
+func TestServerMiddleware_TrustedLevel(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	logger.SetLevel(logs.InfoLevel)
+	handler := NewServerMiddleware(
+		SetServerLogger(logger),
+		SetLogIDHeader("X-Request-Id"),
+		SetLogIDGenerator(func() string { return "generated-logid" }),
+		SetTrustedCaller(func(r *http.Request) bool { return r.Header.Get("X-Internal") == "1" }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Debug(logs.WithCtx(r.Context())).Str("debug in handler").Emit()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(LogLevelHeader, "debug")
+	req.Header.Set("X-Internal", "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, "generated-logid", rec.Header().Get("X-Request-Id"))
+	entries := o.FilterLevel(logs.DebugLevel)
+	logtest.AssertCount(t, entries, 1)
+	assert.Equal(t, "generated-logid", entries[0].LogID)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "status", 200)
+	_, ok := o.FilterLevel(logs.NoticeLevel)[0].KV("panic")
+	assert.False(t, ok)
+}
+
+func TestServerMiddleware_Panic(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	handler := NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	assert.NotPanics(t, func() { handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil)) })
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	errs := o.FilterLevel(logs.ErrorLevel)
+	logtest.AssertCount(t, errs, 1)
+	assert.Contains(t, errs[0].Body, "boom")
+	assert.Contains(t, errs[0].Content, "server_test.go")
+	assert.Len(t, errs[0].LogID, 16)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "status", 500)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "panic", true)
+
+	// the status already sent to the client is kept
+	o.TakeAll()
+	handler = NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	}))
+	rec = httptest.NewRecorder()
+	assert.NotPanics(t, func() { handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil)) })
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "status", 202)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "panic", true)
+
+	// http.ErrAbortHandler is not recovered
+	handler = NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.Panics(t, func() { handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)) })
+}
+
+func TestServerMiddleware_InvalidLogID(t *testing.T) {
+	logger, _ := logtest.NewLogger()
+	handler := NewServerMiddleware(SetServerLogger(logger), SetLogIDGenerator(func() string { return "generated-logid" }))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for logID, expected := range map[string]string{
+		"20240715-abc_1.2":      "20240715-abc_1.2",
+		strings.Repeat("a", 64): strings.Repeat("a", 64),
+		strings.Repeat("a", 65): "generated-logid",
+		"bad logid":             "generated-logid",
+		"bad\nlogid":            "generated-logid",
+		"bad=\"logid\"":         "generated-logid",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultLogIDHeader, logID)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, expected, rec.Header().Get(DefaultLogIDHeader), logID)
+	}
+}
+
+type plainWriter struct {
+	header http.Header
+}
+
+func (w *plainWriter) Header() http.Header         { return w.header }
+func (w *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainWriter) WriteHeader(int)             {}
+
+func TestServerMiddleware_Interfaces(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	var flusher, hijacker bool
+	handler := NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		if flusher {
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, flusher)
+	assert.False(t, hijacker)
+	assert.True(t, rec.Flushed)
+	logtest.AssertKV(t, o.FilterLevel(logs.NoticeLevel)[0], "status", 200)
+
+	handler.ServeHTTP(&plainWriter{header: http.Header{}}, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, flusher)
+	assert.False(t, hijacker)
+}
+
+func TestServerMiddleware_Hijack(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	server := httptest.NewServer(NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher := w.(http.Flusher)
+		assert.True(t, flusher)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 418 I'm a teapot\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		_ = buf.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/hijack")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	// the access log is printed after the handler returns, which may be later than the response
+	assert.Eventually(t, func() bool { return len(o.FilterLevel(logs.NoticeLevel)) == 1 }, osTime.Second, osTime.Millisecond)
+	access := o.FilterLevel(logs.NoticeLevel)
+	logtest.AssertKV(t, access[0], "path", "/hijack")
+	logtest.AssertKV(t, access[0], "hijacked", true)
+	_, ok := access[0].KV("status")
+	assert.False(t, ok)
+	_, ok = access[0].KV("bytes")
+	assert.False(t, ok)
+}
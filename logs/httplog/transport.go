@@ -0,0 +1,130 @@
+package httplog
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	osTime "time"
+
+	"github.com/erickxeno/clib/logs"
+)
+
+// TransportOption configures the Transport.
+type TransportOption func(t *Transport)
+
+// Transport is a http.RoundTripper forwarding the logid and a child spanid of the request context in the headers,
+// which are read by the server middleware of the downstream service, and optionally printing the client access logs.
+type Transport struct {
+	base         http.RoundTripper
+	logger       *logs.CLogger
+	logIDHeader  string
+	spanIDHeader string
+	accessLog    bool
+}
+
+// SetTransportLogger sets the logger of the client access logs, logs.V1 by default.
+func SetTransportLogger(logger *logs.CLogger) TransportOption {
+	return func(t *Transport) {
+		t.logger = logger
+	}
+}
+
+// SetTransportLogIDHeader sets the header of the logid, DefaultLogIDHeader by default.
+func SetTransportLogIDHeader(header string) TransportOption {
+	return func(t *Transport) {
+		t.logIDHeader = header
+	}
+}
+
+// SetTransportSpanIDHeader sets the header of the child spanid, DefaultSpanIDHeader by default.
+func SetTransportSpanIDHeader(header string) TransportOption {
+	return func(t *Transport) {
+		t.spanIDHeader = header
+	}
+}
+
+// SetClientAccessLog sets whether to print a client access log for each request,
+// at Info level if it succeeds, otherwise at Warn level.
+func SetClientAccessLog(enable bool) TransportOption {
+	return func(t *Transport) {
+		t.accessLog = enable
+	}
+}
+
+// NewTransport wraps the base RoundTripper, http.DefaultTransport is used if it is nil.
+func NewTransport(base http.RoundTripper, options ...TransportOption) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{
+		base:         base,
+		logIDHeader:  DefaultLogIDHeader,
+		spanIDHeader: DefaultSpanIDHeader,
+	}
+	for _, op := range options {
+		op(t)
+	}
+	return t
+}
+
+// RoundTrip sets the headers on a copy of the request, the headers already set by the caller are kept.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := osTime.Now()
+	ctx := req.Context()
+	logID := logs.LogIDFromCtx(ctx)
+	setLogID := logID != "" && req.Header.Get(t.logIDHeader) == ""
+	spanID := req.Header.Get(t.spanIDHeader)
+	if setLogID || spanID == "" {
+		req = req.Clone(ctx)
+		if setLogID {
+			req.Header.Set(t.logIDHeader, logID)
+		}
+		if spanID == "" {
+			spanID = strconv.FormatUint(newSpanID(), 10)
+			req.Header.Set(t.spanIDHeader, spanID)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if !t.accessLog {
+		return resp, err
+	}
+	var log *logs.Log
+	if err != nil {
+		log = t.getLogger().Warn(logs.WithCtx(ctx))
+	} else {
+		log = t.getLogger().Info(logs.WithCtx(ctx))
+	}
+	if log == nil {
+		return resp, err
+	}
+	target := *req.URL
+	target.RawQuery, target.Fragment, target.User = "", "", nil
+	log.KV("method", req.Method).KV("target", target.String()).KV("child_span_id", spanID)
+	if err != nil {
+		log.KV("error", err.Error())
+	} else {
+		log.KV("status", resp.StatusCode)
+	}
+	log.KV("latency", osTime.Since(start).String()).Emit()
+	return resp, err
+}
+
+func (t *Transport) getLogger() *logs.CLogger {
+	if t.logger != nil {
+		return t.logger
+	}
+	return logs.V1
+}
+
+// newSpanID returns a random non-zero spanid.
+func newSpanID() uint64 {
+	var b [8]byte
+	for {
+		_, _ = rand.Read(b[:])
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package httplog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/erickxeno/clib/logs"
+	"github.com/erickxeno/clib/logs/logtest"
+	"github.com/erickxeno/clib/logs/writer"
+)
+
+func TestTransport(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	server := httptest.NewServer(NewServerMiddleware(SetServerLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Info(logs.WithCtx(r.Context())).Str("downstream").Emit()
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil, SetTransportLogger(logger), SetClientAccessLog(true))}
+	ctx := logs.CtxWithLogID(context.Background(), "upstream-logid")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/path?secret=1", nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Empty(t, req.Header.Get(DefaultLogIDHeader), "the request of the caller is not modified")
+
+	// the logs join up across the hop
+	downstream := o.FilterBody("downstream")
+	logtest.AssertCount(t, downstream, 1)
+	assert.Equal(t, "upstream-logid", downstream[0].LogID)
+	access := o.FilterKV("target", server.URL+"/path")
+	logtest.AssertCount(t, access, 1)
+	assert.Equal(t, logs.InfoLevel, access[0].Level)
+	assert.Equal(t, "upstream-logid", access[0].LogID)
+	logtest.AssertKV(t, access[0], "method", "GET")
+	logtest.AssertKV(t, access[0], "status", 200)
+	childSpanID, _ := access[0].KV("child_span_id")
+	assert.Equal(t, childSpanID, strconv.FormatUint(writer.ExtractContext(downstream[0].Context).SpanID, 10))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestTransport_Headers(t *testing.T) {
+	var header http.Header
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return nil, errors.New("unreachable")
+	})
+	logger, o := logtest.NewLogger()
+
+	// no logid in the context, and the access log is disabled by default
+	transport := NewTransport(base, SetTransportLogger(logger), SetTransportLogIDHeader("X-Request-Id"), SetTransportSpanIDHeader("X-Span"))
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	_, err := transport.RoundTrip(req)
+	assert.NotNil(t, err)
+	assert.Empty(t, header.Get("X-Request-Id"))
+	assert.NotEmpty(t, header.Get("X-Span"))
+	assert.Equal(t, 0, o.Len())
+
+	// the headers set by the caller are kept
+	transport = NewTransport(base, SetTransportLogger(logger), SetClientAccessLog(true))
+	req, _ = http.NewRequestWithContext(logs.CtxWithLogID(context.Background(), "logid"), http.MethodGet, "http://example.com", nil)
+	req.Header.Set(DefaultLogIDHeader, "caller-logid")
+	req.Header.Set(DefaultSpanIDHeader, "42")
+	_, err = transport.RoundTrip(req)
+	assert.NotNil(t, err)
+	assert.Equal(t, "caller-logid", header.Get(DefaultLogIDHeader))
+	assert.Equal(t, "42", header.Get(DefaultSpanIDHeader))
+
+	warns := o.FilterLevel(logs.WarnLevel)
+	logtest.AssertCount(t, warns, 1)
+	logtest.AssertKV(t, warns[0], "error", "unreachable")
+	logtest.AssertKV(t, warns[0], "child_span_id", "42")
+}
@@ -91,6 +91,16 @@ func (l Level) String() string {
 	return "?"
 }
 
+// ParseLevel parses the level name case-insensitively, e.g. "info", "WARN".
+func ParseLevel(s string) (Level, error) {
+	for level := TraceLevel; level <= FatalLevel; level++ {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %q", s)
+}
+
 // KVPosition defines the position of the kv list
 type KVPosition int32
 
@@ -559,6 +569,7 @@ func (l *Log) Emit() {
 	for _, middleware := range l.logger.middlewares { // We only have a metricMiddleware at this point
 		readerLog := middleware(reader)
 		if readerLog == nil {
+			recycle(l)
 			return
 		}
 	}
@@ -700,15 +711,19 @@ func (l *Log) extractKVsFromCtx() *Log {
 	}
 
 	if convertCtxKVListToStr {
-		kvStr := GetAllKVsStr(l.ctx)
-		if len(kvStr) == 0 {
-			return l
+		if kvStr := GetAllKVsStr(l.ctx); len(kvStr) > 0 {
+			l.Str(kvStr)
 		}
-		return l.Str(kvStr)
+	} else {
+		kvList := GetAllKVs(l.ctx)
+		l.KVs(kvList...)
 	}
 
-	kvList := GetAllKVs(l.ctx)
-	return l.KVs(kvList...)
+	// the custom fields of the registered context extractors, e.g. tenant
+	if kvs := writer.ExtractContext(l.ctx).KVs; len(kvs) > 0 {
+		l.KVs(kvs...)
+	}
+	return l
 }
 
 func (l *Log) fetchLoc() string {
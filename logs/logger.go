@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync/atomic"
+	"unsafe"
 
 	"github.com/erickxeno/clib/logs/writer"
 )
@@ -29,6 +30,7 @@ type logger struct {
 	lazyHandleCtx            bool
 	addEnv                   bool
 	compatLoggerDynamicLevel bool
+	vmodule                  unsafe.Pointer // *vmodule, the per-file or per-package levels
 
 	rateLimiters  writer.RateLimiters
 	countLimiters writer.RateLimiters
@@ -64,14 +66,20 @@ func (l *logger) newLog(level Level, ops ...loggerOption) *Log {
 	}
 
 	minLevel, getDynamicLevel := l.CtxLevel(conf.ctx)
+	if vm := l.getVModule(); vm != nil && !getDynamicLevel {
+		// the site level only changes the threshold of the logger, the levels of the writers still apply
+		if siteLevel, ok := vm.siteLevel(); ok {
+			minLevel = siteLevel
+		}
+	}
 	if level < minLevel {
 		return nil
 	}
 
 	lg := newLog(level, l)
+	lg.enableDynamicLevel = getDynamicLevel
 	if conf.ctx != nil {
 		lg.ctx = conf.ctx
-		lg.enableDynamicLevel = getDynamicLevel
 		if !l.lazyHandleCtx {
 			lg.handleCtx()
 		}
@@ -94,6 +102,9 @@ func (l *logger) CtxLevel(ctx context.Context) (Level, bool) {
 			return Level(dynamicLevel), true
 		}
 	}
+	if forcedLevel, ok := forceDebug.level(ctx); ok && forcedLevel < l.GetLevel() {
+		return forcedLevel, true
+	}
 	return l.GetLevel(), false
 }
 
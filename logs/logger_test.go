@@ -707,3 +707,14 @@ func TestGetWriter(t *testing.T) {
 	defer resetDefaultLogger()
 	assert.Len(t, GetWriters(), 4)
 }
+
+func TestCLogger_LocationRecycled(t *testing.T) {
+	V1 := NewCLogger(SetWriter(DebugLevel, newTestWriter(t, []string{
+		"logger_test.go:", "location_test.go:1", "logger_test.go:", "location_test.go:2",
+	})))
+	// the location set to a recycled log is not overwritten by the previous one
+	V1.Info().Str("first").Emit()
+	V1.Error().Location("location_test.go:1").Str("second").Emit()
+	V1.Info().Str("third").Emit()
+	V1.Warn().Location("location_test.go:2").Str("fourth").Emit()
+}
@@ -0,0 +1,69 @@
+package logtest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/erickxeno/clib/logs"
+)
+
+// AssertLogged asserts that a log of the level whose body contains the sub string is observed.
+func AssertLogged(t assert.TestingT, o *Observer, level logs.Level, sub string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	if len(o.All().FilterLevel(level).FilterBody(sub)) > 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("No %s log contains %q, observed logs:\n%s", level, sub, formatEntries(o.All())), msgAndArgs...)
+}
+
+// AssertNotLogged asserts that no log of the level whose body contains the sub string is observed.
+func AssertNotLogged(t assert.TestingT, o *Observer, level logs.Level, sub string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	entries := o.All().FilterLevel(level).FilterBody(sub)
+	if len(entries) == 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("Unexpected %s logs contain %q:\n%s", level, sub, formatEntries(entries)), msgAndArgs...)
+}
+
+// AssertCount asserts the count of the entries.
+func AssertCount(t assert.TestingT, entries Entries, count int, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	if len(entries) == count {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("Expected %d logs, but got %d:\n%s", count, len(entries), formatEntries(entries)), msgAndArgs...)
+}
+
+// AssertKV asserts that the entry has the key-value, the numbers are compared regardless of their types.
+func AssertKV(t assert.TestingT, entry Entry, key string, expected interface{}, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	actual, ok := entry.KV(key)
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("Key %q is not in the log:\n%s", key, entry.Content), msgAndArgs...)
+	}
+	if !valueEqual(actual, expected) {
+		return assert.Fail(t, fmt.Sprintf("Not equal value of key %q:\nexpected: %#v\nactual  : %#v", key, expected, actual), msgAndArgs...)
+	}
+	return true
+}
+
+func formatEntries(entries Entries) string {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString("\t")
+		b.WriteString(e.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
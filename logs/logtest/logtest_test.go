@@ -0,0 +1,77 @@
+package logtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/erickxeno/clib/logs"
+)
+
+func TestObserver_DefaultLogger(t *testing.T) {
+	prev := logs.V1.GetWriter()
+	t.Run("observe", func(t *testing.T) {
+		o := New(t)
+		logs.Info("hello %s", "world")
+		logs.V1.Debug().Str("debug").KV("count", 3).KV("ratio", 0.5).KV("ok", true).KV("name", "alice").Emit()
+		ctx := context.WithValue(context.Background(), "K_LOGID", "logtest-logid")
+		logs.CtxWarnKVs(ctx, "uid", uint64(10086))
+
+		AssertLogged(t, o, logs.InfoLevel, "hello world")
+		AssertNotLogged(t, o, logs.ErrorLevel, "hello")
+		AssertCount(t, o.All(), 3)
+
+		entry := o.FilterLevel(logs.DebugLevel)[0]
+		assert.Equal(t, "debug", entry.Body)
+		assert.Contains(t, entry.Location, "logtest_test.go:")
+		assert.Equal(t, int64(3), entry.KVMap()["count"])
+		AssertKV(t, entry, "count", 3)
+		AssertKV(t, entry, "ratio", 0.5)
+		AssertKV(t, entry, "ok", true)
+		AssertKV(t, entry, "name", "alice")
+
+		warns := o.FilterKV("uid", 10086)
+		AssertCount(t, warns, 1)
+		assert.Equal(t, logs.WarnLevel, warns[0].Level)
+		assert.Equal(t, "logtest-logid", warns[0].LogID)
+
+		assert.Equal(t, []string{"hello world", "debug", ""}, o.TakeAll().Bodies())
+		assert.Equal(t, 0, o.Len())
+	})
+	// the default logger is restored
+	assert.Equal(t, prev, logs.V1.GetWriter())
+}
+
+func TestObserver_NewLogger(t *testing.T) {
+	logger, o := NewLogger(logs.SetPSM("logtest.psm"))
+	logger.Error().Str("failed").KV("code", int64(-1)).Emit()
+	logger.Info().Str("succeeded").Emit()
+
+	entries := o.All()
+	AssertCount(t, entries.FilterMinLevel(logs.WarnLevel), 1)
+	AssertCount(t, entries.FilterBody("succeeded"), 1)
+	AssertCount(t, entries.FilterKV("code", -1), 1)
+	assert.Equal(t, "logtest.psm", entries[0].PSM)
+}
+
+func TestAssertions_Fail(t *testing.T) {
+	logger, o := NewLogger()
+	logger.Info().Str("hello").KV("count", 1).Emit()
+
+	mock := &mockT{}
+	assert.False(t, AssertLogged(mock, o, logs.InfoLevel, "bye"))
+	assert.False(t, AssertNotLogged(mock, o, logs.InfoLevel, "hello"))
+	assert.False(t, AssertCount(mock, o.All(), 2))
+	assert.False(t, AssertKV(mock, o.All()[0], "count", 2))
+	assert.False(t, AssertKV(mock, o.All()[0], "missing", 1))
+	assert.Equal(t, 5, mock.failures)
+}
+
+type mockT struct {
+	failures int
+}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.failures++
+}
@@ -0,0 +1,278 @@
+// Package logtest provides an in-memory observer of the logs for unit tests.
+package logtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	osTime "time"
+
+	"github.com/erickxeno/clib/logs"
+	"github.com/erickxeno/clib/logs/writer"
+)
+
+// KV is a decoded key-value of a log, Value is one of bool, int64, uint64, float64, string and []byte.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry is a decoded log.
+type Entry struct {
+	Level    logs.Level
+	Time     osTime.Time
+	Location string
+	LogID    string
+	PSM      string
+	Body     string
+	Content  string
+	KVs      []KV
+	Context  context.Context
+}
+
+// KV returns the value of the first KV with the key.
+func (e Entry) KV(key string) (interface{}, bool) {
+	for _, kv := range e.KVs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// KVMap returns the KVs as a map, the latter values cover the former ones with the same key.
+func (e Entry) KVMap() map[string]interface{} {
+	res := make(map[string]interface{}, len(e.KVs))
+	for _, kv := range e.KVs {
+		res[kv.Key] = kv.Value
+	}
+	return res
+}
+
+// Entries is a list of entries with query helpers.
+type Entries []Entry
+
+// FilterLevel returns the entries of the level.
+func (es Entries) FilterLevel(level logs.Level) Entries {
+	return es.Filter(func(e Entry) bool { return e.Level == level })
+}
+
+// FilterMinLevel returns the entries of the level or higher.
+func (es Entries) FilterMinLevel(level logs.Level) Entries {
+	return es.Filter(func(e Entry) bool { return e.Level >= level })
+}
+
+// FilterKV returns the entries having the key-value, the numbers are compared regardless of their types,
+// e.g. FilterKV("count", 1) matches the KV whose value is int64(1).
+func (es Entries) FilterKV(key string, value interface{}) Entries {
+	return es.Filter(func(e Entry) bool {
+		actual, ok := e.KV(key)
+		return ok && valueEqual(actual, value)
+	})
+}
+
+// FilterBody returns the entries whose body contains the sub string.
+func (es Entries) FilterBody(sub string) Entries {
+	return es.Filter(func(e Entry) bool { return strings.Contains(e.Body, sub) })
+}
+
+// Filter returns the entries matching the function.
+func (es Entries) Filter(match func(Entry) bool) Entries {
+	var res Entries
+	for _, e := range es {
+		if match(e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Bodies returns the bodies of the entries.
+func (es Entries) Bodies() []string {
+	res := make([]string, 0, len(es))
+	for _, e := range es {
+		res = append(res, e.Body)
+	}
+	return res
+}
+
+// Observer is a writer.LogWriter keeping the decoded logs in memory.
+type Observer struct {
+	lock    sync.Mutex
+	entries Entries
+}
+
+// NewObserver creates an Observer.
+func NewObserver() *Observer {
+	return &Observer{}
+}
+
+// New creates an Observer and installs it as the default logger, which is restored after the test.
+// The options are applied to the default logger after the observer is set as its writer at Trace level.
+func New(t testing.TB, ops ...logs.Option) *Observer {
+	o := NewObserver()
+	restore := logs.ReplaceDefaultLogger(append([]logs.Option{logs.SetWriter(logs.TraceLevel, o)}, ops...)...)
+	t.Cleanup(restore)
+	return o
+}
+
+// NewLogger creates a logger writing to an Observer at Trace level.
+func NewLogger(ops ...logs.Option) (*logs.CLogger, *Observer) {
+	o := NewObserver()
+	logger := logs.NewCLogger(append([]logs.Option{logs.SetWriter(logs.TraceLevel, o)}, ops...)...)
+	return logger, o
+}
+
+func (o *Observer) Write(log writer.RecyclableLog) error {
+	defer log.Recycle()
+	entry := decodeEntry(log)
+	o.lock.Lock()
+	o.entries = append(o.entries, entry)
+	o.lock.Unlock()
+	return nil
+}
+
+func (o *Observer) Close() error { return nil }
+func (o *Observer) Flush() error { return nil }
+
+// Len returns the count of the observed logs.
+func (o *Observer) Len() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.entries)
+}
+
+// All returns all the observed logs.
+func (o *Observer) All() Entries {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append(Entries(nil), o.entries...)
+}
+
+// TakeAll returns all the observed logs and clears them.
+func (o *Observer) TakeAll() Entries {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	entries := o.entries
+	o.entries = nil
+	return entries
+}
+
+// FilterLevel returns the observed logs of the level.
+func (o *Observer) FilterLevel(level logs.Level) Entries {
+	return o.All().FilterLevel(level)
+}
+
+// FilterKV returns the observed logs having the key-value.
+func (o *Observer) FilterKV(key string, value interface{}) Entries {
+	return o.All().FilterKV(key, value)
+}
+
+// FilterBody returns the observed logs whose body contains the sub string.
+func (o *Observer) FilterBody(sub string) Entries {
+	return o.All().FilterBody(sub)
+}
+
+func decodeEntry(log writer.RecyclableLog) Entry {
+	level, _ := logs.ParseLevel(log.GetLevel())
+	entry := Entry{
+		Level:    level,
+		Time:     log.GetTime(),
+		Location: string(log.GetLocation()),
+		LogID:    "-",
+		PSM:      string(append([]byte(nil), log.GetPSM()...)), // the psm of the log may be reused
+		Body:     string(log.GetBody()),
+		Content:  string(log.GetContent()),
+		Context:  log.GetContext(),
+	}
+	if ctx := log.GetContext(); ctx != nil {
+		if logID := writer.ExtractContext(ctx).LogID; logID != "" {
+			entry.LogID = logID
+		}
+	}
+	kvs := log.GetKVList()
+	if len(kvs) > 0 {
+		entry.KVs = make([]KV, 0, len(kvs))
+		for _, kv := range kvs {
+			entry.KVs = append(entry.KVs, KV{Key: kv.Key, Value: decodeValue(kv)})
+		}
+	}
+	return entry
+}
+
+func decodeValue(kv *writer.KeyValue) interface{} {
+	switch kv.ValueType {
+	case writer.BoolType:
+		return len(kv.Value) > 0 && kv.Value[0] == 1
+	case writer.IntType:
+		v, _ := writer.DecodeUint32(kv.Value)
+		return int64(int32(v))
+	case writer.LongType:
+		v, _ := writer.DecodeUint64(kv.Value)
+		return int64(v)
+	case writer.Uint64Type:
+		v, _ := writer.DecodeUint64(kv.Value)
+		return v
+	case writer.DoubleType:
+		v, _ := writer.DecodeUint64(kv.Value)
+		return math.Float64frombits(v)
+	case writer.BytesType:
+		return append([]byte(nil), kv.Value...)
+	case writer.StringType, writer.TextType:
+		return string(kv.Value)
+	default:
+		_, v := kv.ToKV()
+		return v
+	}
+}
+
+// valueEqual compares the decoded value with the expected one, the numbers are compared by their values.
+func valueEqual(actual, expected interface{}) bool {
+	switch a := actual.(type) {
+	case int64:
+		switch e := expected.(type) {
+		case int:
+			return a == int64(e)
+		case int8:
+			return a == int64(e)
+		case int16:
+			return a == int64(e)
+		case int32:
+			return a == int64(e)
+		case int64:
+			return a == e
+		case uint8:
+			return a == int64(e)
+		case uint16:
+			return a == int64(e)
+		case uint32:
+			return a == int64(e)
+		}
+	case uint64:
+		switch e := expected.(type) {
+		case uint:
+			return a == uint64(e)
+		case uint32:
+			return a == uint64(e)
+		case uint64:
+			return a == e
+		case int:
+			return e >= 0 && a == uint64(e)
+		}
+	case float64:
+		switch e := expected.(type) {
+		case float32:
+			return a == float64(e)
+		case float64:
+			return a == e
+		}
+	case []byte:
+		if e, ok := expected.([]byte); ok {
+			return string(a) == string(e)
+		}
+	}
+	return actual == expected || fmt.Sprint(actual) == fmt.Sprint(expected)
+}
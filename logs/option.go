@@ -64,6 +64,18 @@ func SetMiddleware(m ...Middleware) Option {
 	}
 }
 
+// SetSampling samples the logs by logid with the kept ratio of each level,
+// see NewSamplingMiddleware for details.
+func SetSampling(ratios map[Level]float64) Option {
+	return SetMiddleware(NewSamplingMiddleware(ratios))
+}
+
+// SetRedaction masks the sensitive keys and patterns in the logs,
+// see NewRedactMiddleware for details.
+func SetRedaction(options ...RedactOption) Option {
+	return SetMiddleware(NewRedactMiddleware(options...))
+}
+
 // UpdateMiddleware sets middleware to the logger
 func UpdateMiddleware(m ...Middleware) Option {
 	return func(logger *CLogger) {
@@ -72,6 +84,16 @@ func UpdateMiddleware(m ...Middleware) Option {
 	}
 }
 
+// WithVModule sets the per-file or per-package levels, e.g. "storage/*.go=debug".
+// It panics if the spec is invalid, use logger.SetVModule to change them at runtime.
+func WithVModule(spec string) Option {
+	return func(logger *CLogger) {
+		if err := logger.SetVModule(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // SetFullPath sets print the full path of log file location.
 func SetFullPath(fullpath bool) Option {
 	return func(logger *CLogger) {
@@ -85,7 +85,8 @@ func (l *prefixedLog) Location() *prefixedLog {
 			}
 		}
 		l.appendStrings(fileLine, " ")
-		l.loc = l.buf[len(l.buf)-len(fileLine)-1 : len(l.buf)-1]
+		// keep loc apart from buf, otherwise Location of the recycled log overwrites buf
+		l.loc = append(l.loc[:0], fileLine...)
 	})
 	return l
 }
@@ -0,0 +1,259 @@
+package logs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erickxeno/clib/logs/writer"
+)
+
+// RedactStrategy decides how to mask a sensitive value.
+type RedactStrategy int
+
+const (
+	// RedactFull replaces the value with "******", the length of the value is hidden as well.
+	RedactFull RedactStrategy = iota
+	// RedactKeepLast4 keeps the last 4 characters of the value, e.g. "*******5678".
+	RedactKeepLast4
+	// RedactHash replaces the value with a stable hash, e.g. "sha256:1f2e3d4c5b6a7988",
+	// so that the logs of the same value can still be correlated.
+	RedactHash
+)
+
+const (
+	redactFullMask   = "******"
+	redactHashPrefix = "sha256:"
+
+	// the same as the pattern of convert.IsCnMobile, but not anchored.
+	cnMobilePattern = `(0|\+?86)?1[3-9][0-9]{9}`
+	emailPattern    = `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`
+)
+
+type redactPattern struct {
+	re       *regexp.Regexp
+	strategy RedactStrategy
+	// digitBounded means the match is skipped if it is adjacent to other digits.
+	digitBounded bool
+}
+
+type redactor struct {
+	keys     map[string]RedactStrategy // keys in lower case
+	bodyKeys *regexp.Regexp            // matches "key=value" and "key":"value" in bodies
+	patterns []redactPattern
+}
+
+// RedactOption configures the redaction middleware.
+type RedactOption func(r *redactor)
+
+// RedactKeys masks the values of the keys, the keys are case-insensitive.
+// The KVs with these keys are masked, and so are "key=value" and "key":"value" in the log body.
+func RedactKeys(strategy RedactStrategy, keys ...string) RedactOption {
+	return func(r *redactor) {
+		for _, key := range keys {
+			r.keys[strings.ToLower(key)] = strategy
+		}
+	}
+}
+
+// RedactPattern masks the text matching the pattern in the log body and in the KV values.
+func RedactPattern(strategy RedactStrategy, pattern *regexp.Regexp) RedactOption {
+	return func(r *redactor) {
+		r.patterns = append(r.patterns, redactPattern{re: pattern, strategy: strategy})
+	}
+}
+
+// RedactCnMobile masks the CN mobile numbers, which are recognized in the same way as convert.IsCnMobile.
+func RedactCnMobile(strategy RedactStrategy) RedactOption {
+	return func(r *redactor) {
+		r.patterns = append(r.patterns, redactPattern{
+			re:           regexp.MustCompile(cnMobilePattern),
+			strategy:     strategy,
+			digitBounded: true,
+		})
+	}
+}
+
+// RedactEmail masks the email addresses.
+func RedactEmail(strategy RedactStrategy) RedactOption {
+	return func(r *redactor) {
+		r.patterns = append(r.patterns, redactPattern{re: regexp.MustCompile(emailPattern), strategy: strategy})
+	}
+}
+
+// NewRedactMiddleware creates a middleware masking the sensitive keys and patterns in the log body and KV list.
+// The logs without any sensitive content are passed through without allocation.
+func NewRedactMiddleware(options ...RedactOption) Middleware {
+	r := &redactor{keys: make(map[string]RedactStrategy)}
+	for _, option := range options {
+		option(r)
+	}
+	if len(r.keys) > 0 {
+		keys := make([]string, 0, len(r.keys))
+		for key := range r.keys {
+			keys = append(keys, regexp.QuoteMeta(key))
+		}
+		// the quoted values end at the closing quote and may contain spaces, e.g. {"password": "my secret"}
+		r.bodyKeys = regexp.MustCompile(`(?i)\b(` + strings.Join(keys, "|") +
+			`)(?:("?\s*[=:]\s*")([^"]+)|("?\s*[=:]\s*)([^\s",;&}]+))`)
+	}
+
+	return func(log RewritableLog) RewritableLog {
+		if body, ok := r.redactText(log.GetBody()); ok {
+			log.SetBody(body)
+		}
+		r.redactKVs(log)
+		return log
+	}
+}
+
+func (r *redactor) redactKVs(log RewritableLog) {
+	kvlist := log.GetKVList()
+	changed := false
+	var scratch writer.Packet
+	for i, kv := range kvlist {
+		if strategy, ok := r.keyStrategy(kv.Key); ok {
+			masked := r.mask(nil, kv.AppendValueStr(nil), strategy)
+			kvlist[i] = writer.NewStrKeyValue(kv.Key, string(masked), kv.IsLong())
+			kv.Recycle()
+			changed = true
+			continue
+		}
+		if len(r.patterns) == 0 || kv.ValueType == writer.BytesType || kv.ValueType == writer.BoolType {
+			continue
+		}
+		value := kv.Value
+		if kv.ValueType != writer.StringType && kv.ValueType != writer.TextType {
+			if scratch == nil {
+				scratch = writer.NewPacket(0)
+			}
+			*scratch = kv.AppendValueStr((*scratch)[:0])
+			value = *scratch
+		}
+		if masked, ok := r.redactPatterns(value); ok {
+			kvlist[i] = writer.NewStrKeyValue(kv.Key, string(masked), kv.IsLong())
+			kv.Recycle()
+			changed = true
+		}
+	}
+	if scratch != nil {
+		writer.PutPacket(scratch)
+	}
+	if changed {
+		log.SetKVList(kvlist)
+	}
+}
+
+func (r *redactor) keyStrategy(key string) (RedactStrategy, bool) {
+	if len(r.keys) == 0 {
+		return 0, false
+	}
+	if strategy, ok := r.keys[key]; ok {
+		return strategy, true
+	}
+	if strings.ToLower(key) == key {
+		return 0, false
+	}
+	strategy, ok := r.keys[strings.ToLower(key)]
+	return strategy, ok
+}
+
+// redactText masks the keys and patterns in the text, it returns false if nothing is masked.
+func (r *redactor) redactText(text []byte) ([]byte, bool) {
+	changed := false
+	// "key=value" and "key":"value" always have a '=' or ':', which is much cheaper to check than the regexp
+	if r.bodyKeys != nil && bytes.ContainsAny(text, "=:") {
+		if locs := r.bodyKeys.FindAllSubmatchIndex(text, -1); len(locs) > 0 {
+			res := make([]byte, 0, len(text))
+			last := 0
+			for _, loc := range locs {
+				strategy, _ := r.keyStrategy(string(text[loc[2]:loc[3]]))
+				start, end := loc[6], loc[7]
+				if start < 0 {
+					// the unquoted value
+					start, end = loc[10], loc[11]
+				}
+				res = append(res, text[last:start]...)
+				res = r.mask(res, text[start:end], strategy)
+				last = end
+			}
+			text = append(res, text[last:]...)
+			changed = true
+		}
+	}
+	if masked, ok := r.redactPatterns(text); ok {
+		return masked, true
+	}
+	return text, changed
+}
+
+func (r *redactor) redactPatterns(text []byte) ([]byte, bool) {
+	changed := false
+	for _, pattern := range r.patterns {
+		locs := pattern.re.FindAllIndex(text, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		var res []byte
+		last := 0
+		for _, loc := range locs {
+			if pattern.digitBounded && !isDigitBounded(text, loc[0], loc[1]) {
+				continue
+			}
+			if res == nil {
+				res = make([]byte, 0, len(text))
+			}
+			res = append(res, text[last:loc[0]]...)
+			res = r.mask(res, text[loc[0]:loc[1]], pattern.strategy)
+			last = loc[1]
+		}
+		if res == nil {
+			continue
+		}
+		text = append(res, text[last:]...)
+		changed = true
+	}
+	return text, changed
+}
+
+func isDigitBounded(text []byte, start, end int) bool {
+	if start > 0 && (isDigit(text[start-1]) || text[start-1] == '+') {
+		return false
+	}
+	return end >= len(text) || !isDigit(text[end])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// mask appends the masked value to buf.
+func (r *redactor) mask(buf []byte, value []byte, strategy RedactStrategy) []byte {
+	switch strategy {
+	case RedactKeepLast4:
+		count := utf8.RuneCount(value)
+		if count <= 4 {
+			return append(buf, "****"[:count]...)
+		}
+		i := len(value)
+		for n := 0; n < 4; n++ {
+			_, size := utf8.DecodeLastRune(value[:i])
+			i -= size
+		}
+		for n := 0; n < count-4; n++ {
+			buf = append(buf, '*')
+		}
+		return append(buf, value[i:]...)
+	case RedactHash:
+		sum := sha256.Sum256(value)
+		buf = append(buf, redactHashPrefix...)
+		dst := make([]byte, 16)
+		hex.Encode(dst, sum[:8])
+		return append(buf, dst...)
+	default:
+		return append(buf, redactFullMask...)
+	}
+}
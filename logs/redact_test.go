@@ -0,0 +1,114 @@
+package logs
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	w "github.com/erickxeno/clib/logs/writer"
+)
+
+type contentRecorder struct {
+	lock     sync.Mutex
+	contents []string
+}
+
+func (r *contentRecorder) Write(log w.RecyclableLog) error {
+	defer log.Recycle()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.contents = append(r.contents, string(log.GetContent()))
+	return nil
+}
+
+func (r *contentRecorder) Close() error {
+	return nil
+}
+
+func (r *contentRecorder) Flush() error {
+	return nil
+}
+
+func (r *contentRecorder) last() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.contents) == 0 {
+		return ""
+	}
+	return r.contents[len(r.contents)-1]
+}
+
+func newRedactLogger(options ...RedactOption) (*CLogger, *contentRecorder) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder), SetRedaction(options...))
+	return logger, recorder
+}
+
+func TestRedactMiddleware_Keys(t *testing.T) {
+	logger, recorder := newRedactLogger(
+		RedactKeys(RedactFull, "password", "Token"),
+		RedactKeys(RedactKeepLast4, "card"),
+		RedactKeys(RedactHash, "user_id"),
+	)
+
+	logger.Info().KV("PassWord", "secret").KV("token", 123456).KV("card", "6222021234567890").
+		KV("user_id", "u1").KV("name", "alice").Emit()
+	content := recorder.last()
+	assert.Contains(t, content, "PassWord=******")
+	assert.Contains(t, content, "token=******")
+	assert.Contains(t, content, "card=************7890")
+	assert.Regexp(t, `user_id=sha256:[0-9a-f]{16}`, content)
+	assert.Contains(t, content, "name=alice")
+	assert.NotContains(t, content, "secret")
+	assert.NotContains(t, content, "123456")
+
+	// the hash is stable
+	hashed := regexp.MustCompile(`sha256:[0-9a-f]{16}`).FindString(content)
+	logger.Info().KV("user_id", "u1").Emit()
+	assert.Contains(t, recorder.last(), hashed)
+
+	// keys in the body
+	logger.Info().Str("login with").Str("password=abc123").Str(`{"token": "xyz"}`).Str("access_token=keep").Emit()
+	content = recorder.last()
+	assert.Contains(t, content, "password=******")
+	assert.Contains(t, content, `{"token": "******"}`)
+	assert.Contains(t, content, "access_token=keep")
+
+	// the quoted values may contain spaces
+	logger.Info().Str(`{"password":"my secret","name":"alice"}`).Str(`password="a b c"`).Emit()
+	content = recorder.last()
+	assert.Contains(t, content, `{"password":"******","name":"alice"}`)
+	assert.Contains(t, content, `password="******"`)
+	assert.NotContains(t, content, "secret")
+}
+
+func TestRedactMiddleware_Patterns(t *testing.T) {
+	logger, recorder := newRedactLogger(
+		RedactCnMobile(RedactKeepLast4),
+		RedactEmail(RedactFull),
+		RedactPattern(RedactFull, regexp.MustCompile(`sk-[a-z0-9]{8}`)),
+	)
+
+	logger.Info().Str("call 13812345678 or +8613912345678, mail alice@example.com").Emit()
+	content := recorder.last()
+	assert.Contains(t, content, "call *******5678 or **********5678, mail ******")
+	assert.NotContains(t, content, "example.com")
+
+	// too long to be a mobile number
+	logger.Info().Str("order 138123456789").Emit()
+	assert.Contains(t, recorder.last(), "order 138123456789")
+
+	logger.Info().KV("phone", int64(13812345678)).KV("key", "sk-abcd1234").KV("ok", true).Emit()
+	content = recorder.last()
+	assert.Contains(t, content, "phone=*******5678")
+	assert.Contains(t, content, "key=******")
+	assert.Contains(t, content, "ok=true")
+}
+
+func TestRedactMiddleware_Untouched(t *testing.T) {
+	logger, recorder := newRedactLogger(RedactKeys(RedactFull, "password"), RedactCnMobile(RedactFull))
+	logger.Info().Str("nothing").Str("sensitive").KV("count", 10).Emit()
+	assert.Contains(t, recorder.last(), "count=10 nothing sensitive")
+}
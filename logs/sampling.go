@@ -0,0 +1,62 @@
+package logs
+
+import (
+	"github.com/spaolacci/murmur3"
+)
+
+// murmurDefaultSeed is the seed of utils.MurmurSum32,
+// the sampling decision of a logid agrees with other services hashing it with utils.MurmurSum32.
+const murmurDefaultSeed uint32 = 0xe31e8a70
+
+// NewSamplingMiddleware creates a middleware sampling the logs by logid,
+// ratios is the kept ratio in [0, 1] of each level, e.g. {InfoLevel: 0.1, DebugLevel: 0.01}.
+// The decision only depends on the hash of the logid, so all the logs of a sampled request are kept,
+// and the services sampling with the same ratio agree with each other.
+// Warn and higher logs are always kept, and so are the logs without logid or of the levels not in ratios.
+func NewSamplingMiddleware(ratios map[Level]float64) Middleware {
+	// the thresholds of the hash, indexed by level
+	var thresholds [FatalLevel + 1]uint64
+	for i := range thresholds {
+		thresholds[i] = 1 << 32
+	}
+	for level, ratio := range ratios {
+		if level < TraceLevel || level >= WarnLevel {
+			continue
+		}
+		switch {
+		case ratio <= 0:
+			thresholds[level] = 0
+		case ratio < 1:
+			thresholds[level] = uint64(ratio * (1 << 32))
+		}
+	}
+	return func(log RewritableLog) RewritableLog {
+		level, ok := levelNames[log.GetLevel()]
+		if !ok || thresholds[level] >= 1<<32 {
+			return log
+		}
+		logID := logIDFromContext(log.GetContext())
+		if logID == "-" {
+			return log
+		}
+		if sampledByLogID(logID, thresholds[level]) {
+			return log
+		}
+		return nil
+	}
+}
+
+// sampledByLogID reports whether the hash of the logid is lower than the threshold in [0, 1<<32].
+func sampledByLogID(logID string, threshold uint64) bool {
+	return uint64(murmur3.Sum32WithSeed([]byte(logID), murmurDefaultSeed)) < threshold
+}
+
+var levelNames = map[string]Level{
+	TraceLevel.String():  TraceLevel,
+	DebugLevel.String():  DebugLevel,
+	InfoLevel.String():   InfoLevel,
+	NoticeLevel.String(): NoticeLevel,
+	WarnLevel.String():   WarnLevel,
+	ErrorLevel.String():  ErrorLevel,
+	FatalLevel.String():  FatalLevel,
+}
@@ -0,0 +1,70 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingMiddleware_ConsistentByLogID(t *testing.T) {
+	writer := newTestWriter(t, nil)
+	logger := NewCLogger(SetWriter(TraceLevel, writer), SetSampling(map[Level]float64{
+		InfoLevel:  0.5,
+		DebugLevel: 0.5,
+	}))
+	logger.SetLevel(TraceLevel)
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		logID := fmt.Sprintf("2023%08d", i)
+		ctx := context.WithValue(context.Background(), logIDCtxKey, logID)
+		before := writer.i
+		logger.Info().With(ctx).Str("info").Emit()
+		logger.Debug().With(ctx).Str("debug").Emit()
+		logger.Info().With(ctx).Str("info again").Emit()
+		written := writer.i - before
+		// all or nothing for one logid
+		assert.Contains(t, []int{0, 3}, written)
+		assert.Equal(t, sampledByLogID(logID, 1<<31), written == 3)
+		if written == 3 {
+			kept++
+		}
+	}
+	assert.InDelta(t, 500, kept, 100)
+}
+
+func TestSamplingMiddleware_AlwaysKept(t *testing.T) {
+	writer := newTestWriter(t, nil)
+	logger := NewCLogger(SetWriter(TraceLevel, writer), SetSampling(map[Level]float64{
+		InfoLevel: 0,
+		WarnLevel: 0,
+	}))
+	logger.SetLevel(TraceLevel)
+
+	ctx := context.WithValue(context.Background(), logIDCtxKey, "20230101000000")
+	logger.Info().With(ctx).Str("dropped").Emit()
+	assert.Equal(t, 0, writer.i)
+
+	logger.Warn().With(ctx).Str("warn").Emit()
+	logger.Error().With(ctx).Str("error").Emit()
+	assert.Equal(t, 2, writer.i)
+
+	// levels not in ratios
+	logger.Debug().With(ctx).Str("debug").Emit()
+	assert.Equal(t, 3, writer.i)
+
+	// logs without logid
+	logger.Info().With(context.Background()).Str("no logid").Emit()
+	logger.Info().Str("no ctx").Emit()
+	assert.Equal(t, 5, writer.i)
+}
+
+func TestSampledByLogID(t *testing.T) {
+	assert.False(t, sampledByLogID("hello", 0))
+	assert.True(t, sampledByLogID("hello", 1<<32))
+	// 0xeac790e5 is the hash of "hello" with the default seed
+	assert.True(t, sampledByLogID("hello", 0xeac790e6))
+	assert.False(t, sampledByLogID("hello", 0xeac790e5))
+}
@@ -0,0 +1,4 @@
+// Package sloghandler provides a log/slog Handler backed by logs.CLogger,
+// so that the logs of slog share the writers, middlewares and levels of clib.
+// It requires Go 1.21 or later.
+package sloghandler
@@ -0,0 +1,176 @@
+//go:build go1.21
+
+package sloghandler
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	osTime "time"
+
+	"github.com/erickxeno/clib/logs"
+)
+
+// The slog levels of the logs levels which slog does not define.
+const (
+	LevelTrace  = slog.Level(-8)
+	LevelNotice = slog.Level(2)
+)
+
+type boundKV struct {
+	key   string
+	value interface{}
+}
+
+// Handler is a slog.Handler printing the records by logs.CLogger.
+// The attrs are printed as KVs, and the keys in groups are joined by dots, e.g. "request.id".
+type Handler struct {
+	logger *logs.CLogger
+	kvs    []boundKV // bound by WithAttrs
+	prefix string    // the groups joined by dots
+}
+
+// NewHandler creates a Handler printing the records by the logger.
+func NewHandler(logger *logs.CLogger) *Handler {
+	return &Handler{logger: logger}
+}
+
+// New creates a slog.Logger printing the records by the logger.
+func New(logger *logs.CLogger) *slog.Logger {
+	return slog.New(NewHandler(logger))
+}
+
+// ToLevel maps the slog level to the logs level, each level covers the range up to the next one,
+// e.g. the levels below LevelDebug are Trace and the levels in [LevelNotice, LevelWarn) are Notice.
+// The levels above LevelError are still Error, a slog record never takes the Fatal path of the logger.
+func ToLevel(level slog.Level) logs.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return logs.TraceLevel
+	case level < slog.LevelInfo:
+		return logs.DebugLevel
+	case level < LevelNotice:
+		return logs.InfoLevel
+	case level < slog.LevelWarn:
+		return logs.NoticeLevel
+	case level < slog.LevelError:
+		return logs.WarnLevel
+	default:
+		return logs.ErrorLevel
+	}
+}
+
+// Enabled reports whether the level is enabled by the logger with the context, the dynamic levels are respected.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	minLevel, _ := h.logger.CtxLevel(ctx)
+	return ToLevel(level) >= minLevel
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	log := h.newLog(ctx, ToLevel(r.Level))
+	if log == nil {
+		return nil
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if frame.File != "" {
+			log.Location(h.logger.FormatLocation(frame.File, frame.Line))
+		}
+	}
+	log.Str(r.Message)
+	for _, kv := range h.kvs {
+		log.KV(kv.key, kv.value)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		appendAttr(h.prefix, attr, func(key string, value interface{}) {
+			log.KV(key, value)
+		})
+		return true
+	})
+	log.Emit()
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.kvs = make([]boundKV, len(h.kvs), len(h.kvs)+len(attrs))
+	copy(h2.kvs, h.kvs)
+	for _, attr := range attrs {
+		appendAttr(h.prefix, attr, func(key string, value interface{}) {
+			h2.kvs = append(h2.kvs, boundKV{key: key, value: value})
+		})
+	}
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func (h *Handler) newLog(ctx context.Context, level logs.Level) *logs.Log {
+	switch level {
+	case logs.TraceLevel:
+		return h.logger.Trace(logs.WithCtx(ctx))
+	case logs.DebugLevel:
+		return h.logger.Debug(logs.WithCtx(ctx))
+	case logs.InfoLevel:
+		return h.logger.Info(logs.WithCtx(ctx))
+	case logs.NoticeLevel:
+		return h.logger.Notice(logs.WithCtx(ctx))
+	case logs.WarnLevel:
+		return h.logger.Warn(logs.WithCtx(ctx))
+	default:
+		return h.logger.Error(logs.WithCtx(ctx))
+	}
+}
+
+// appendAttr resolves the attr and calls add with the flattened key-values following the rules of slog.Handler:
+// the empty attrs are ignored, and the groups with empty keys are inlined.
+func appendAttr(prefix string, attr slog.Attr, add func(key string, value interface{})) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	value := attr.Value
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		if len(group) == 0 {
+			return
+		}
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range group {
+			appendAttr(prefix, a, add)
+		}
+	case slog.KindString:
+		add(prefix+attr.Key, value.String())
+	case slog.KindInt64:
+		add(prefix+attr.Key, value.Int64())
+	case slog.KindUint64:
+		add(prefix+attr.Key, value.Uint64())
+	case slog.KindFloat64:
+		add(prefix+attr.Key, value.Float64())
+	case slog.KindBool:
+		add(prefix+attr.Key, value.Bool())
+	case slog.KindDuration:
+		add(prefix+attr.Key, value.Duration().String())
+	case slog.KindTime:
+		add(prefix+attr.Key, value.Time().Format(osTime.RFC3339Nano))
+	default:
+		if err, ok := value.Any().(error); ok {
+			add(prefix+attr.Key, err.Error())
+			return
+		}
+		add(prefix+attr.Key, value.Any())
+	}
+}
@@ -0,0 +1,91 @@
+//go:build go1.21
+
+package sloghandler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/erickxeno/clib/logs"
+	"github.com/erickxeno/clib/logs/logtest"
+)
+
+func TestHandler_Levels(t *testing.T) {
+	assert.Equal(t, logs.TraceLevel, ToLevel(LevelTrace))
+	assert.Equal(t, logs.DebugLevel, ToLevel(slog.LevelDebug))
+	assert.Equal(t, logs.InfoLevel, ToLevel(slog.LevelInfo))
+	assert.Equal(t, logs.NoticeLevel, ToLevel(LevelNotice))
+	assert.Equal(t, logs.WarnLevel, ToLevel(slog.LevelWarn))
+	assert.Equal(t, logs.ErrorLevel, ToLevel(slog.LevelError))
+	assert.Equal(t, logs.ErrorLevel, ToLevel(slog.LevelError+4))
+
+	logger, o := logtest.NewLogger()
+	logger.SetLevel(logs.InfoLevel)
+	l := New(logger)
+	ctx := context.Background()
+	assert.False(t, l.Enabled(ctx, slog.LevelDebug))
+	assert.True(t, l.Enabled(ctx, slog.LevelInfo))
+
+	l.Debug("hidden")
+	l.Info("shown")
+	l.Log(ctx, LevelNotice, "notice")
+	assert.Equal(t, []string{"shown", "notice"}, o.All().Bodies())
+	assert.Equal(t, logs.NoticeLevel, o.All()[1].Level)
+
+	// the levels above Error are printed as Error without exiting
+	l.Log(ctx, slog.LevelError+8, "critical")
+	logtest.AssertLogged(t, o, logs.ErrorLevel, "critical")
+
+	// the dynamic level of the context is respected
+	ctx = context.WithValue(ctx, logs.DynamicLogLevelKey, logs.DebugLevel)
+	assert.True(t, l.Enabled(ctx, slog.LevelDebug))
+	l.DebugContext(ctx, "dynamic")
+	logtest.AssertLogged(t, o, logs.DebugLevel, "dynamic")
+}
+
+func TestHandler_FullPath(t *testing.T) {
+	logger, o := logtest.NewLogger(logs.SetFullPath(true))
+	New(logger).Info("full")
+	_, file, _, _ := runtime.Caller(0)
+	assert.True(t, strings.HasPrefix(o.All()[0].Location, file+":"), o.All()[0].Location)
+}
+
+func TestHandler_Attrs(t *testing.T) {
+	logger, o := logtest.NewLogger()
+	l := New(logger).With("service", "api").WithGroup("req").With(slog.Int("id", 7))
+	ctx := context.WithValue(context.Background(), "K_LOGID", "slog-logid")
+	l.ErrorContext(ctx, "failed",
+		slog.String("method", "GET"),
+		slog.Group("user", slog.Uint64("uid", 10086), slog.Bool("vip", true)),
+		slog.Group("", slog.Float64("ratio", 0.5)),
+		slog.Group("empty"),
+		slog.Attr{},
+		slog.Duration("cost", 1500*osTime.Millisecond),
+		slog.Any("err", errors.New("boom")),
+	)
+
+	entry := o.All()[0]
+	assert.Equal(t, logs.ErrorLevel, entry.Level)
+	assert.Equal(t, "failed", entry.Body)
+	assert.Equal(t, "slog-logid", entry.LogID)
+	assert.Regexp(t, `^handler_test\.go:\d+$`, entry.Location)
+	keys := make([]string, 0, len(entry.KVs))
+	for _, kv := range entry.KVs {
+		keys = append(keys, kv.Key)
+	}
+	assert.Equal(t, []string{"service", "req.id", "req.method", "req.user.uid", "req.user.vip", "req.ratio", "req.cost", "req.err"}, keys)
+	logtest.AssertKV(t, entry, "service", "api")
+	logtest.AssertKV(t, entry, "req.id", 7)
+	logtest.AssertKV(t, entry, "req.user.uid", 10086)
+	logtest.AssertKV(t, entry, "req.user.vip", true)
+	logtest.AssertKV(t, entry, "req.ratio", 0.5)
+	logtest.AssertKV(t, entry, "req.cost", "1.5s")
+	logtest.AssertKV(t, entry, "req.err", "boom")
+}
@@ -0,0 +1,156 @@
+package logs
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+const (
+	// lineWriterMaxLineSize is the max size of a line buffered by LineWriter, the longer lines are split.
+	lineWriterMaxLineSize = 64 * 1024
+
+	lineWriterMaxDepth = 32
+)
+
+// LineWriter is an io.Writer printing each line written to it as a log, e.g. the output of the stdlib logger
+// or the stdout/stderr of exec.Cmd. The partial lines are buffered until the newline, Flush or Close.
+// It is safe for concurrent use.
+type LineWriter struct {
+	logger      *CLogger
+	level       Level
+	kvs         []interface{}
+	maxLineSize int
+	// location is the call site creating the writer, used when no caller outside the stdlib is found.
+	location string
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+// NewLineWriter creates a LineWriter printing the lines at the level by the logger, with the key-values attached,
+// e.g. NewLineWriter(logger, logs.InfoLevel, "cmd", "ffmpeg").
+func NewLineWriter(logger *CLogger, level Level, kvs ...interface{}) *LineWriter {
+	return newLineWriter(logger, level, kvs)
+}
+
+// newLineWriter creates a LineWriter whose fallback location is the caller of its caller.
+func newLineWriter(logger *CLogger, level Level, kvs []interface{}) *LineWriter {
+	w := &LineWriter{
+		logger:      logger,
+		level:       level,
+		kvs:         kvs,
+		maxLineSize: lineWriterMaxLineSize,
+	}
+	// skip newLineWriter and NewLineWriter or RedirectStdLog
+	if _, file, line, ok := runtime.Caller(2); ok {
+		w.location = w.logger.FormatLocation(filepath.ToSlash(file), line)
+	}
+	return w
+}
+
+// Write prints the complete lines in p and buffers the trailing partial line.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	location := ""
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			for len(w.buf) >= w.maxLineSize {
+				if location == "" {
+					location = w.callerLocation()
+				}
+				w.emit(w.buf[:w.maxLineSize], location)
+				w.buf = w.buf[:copy(w.buf, w.buf[w.maxLineSize:])]
+			}
+			break
+		}
+		if location == "" {
+			location = w.callerLocation()
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, line...)
+			line = w.buf
+		}
+		for len(line) > w.maxLineSize {
+			w.emit(line[:w.maxLineSize], location)
+			line = line[w.maxLineSize:]
+		}
+		w.emit(line, location)
+		w.buf = w.buf[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Flush prints the buffered partial line.
+func (w *LineWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf, w.callerLocation())
+		w.buf = w.buf[:0]
+	}
+	return nil
+}
+
+// Close prints the buffered partial line, the logger is not closed.
+func (w *LineWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *LineWriter) emit(line []byte, location string) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	log := w.logger.prefix(w.logger.newLog(w.level))
+	if log == nil {
+		return
+	}
+	log.Location(location).Str(string(line))
+	if len(w.kvs) > 0 {
+		log.KVs(w.kvs...)
+	}
+	log.Emit()
+}
+
+// callerLocation returns the location of the first caller outside this module and the stdlib,
+// e.g. the caller of log.Printf, or the location creating the writer if there is none like in exec.Cmd.
+func (w *LineWriter) callerLocation() string {
+	var pcs [lineWriterMaxDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		file := filepath.ToSlash(frame.File)
+		if frame.Function != "" && !isLibraryFrame(file, frame.Function) {
+			return w.logger.FormatLocation(file, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return w.location
+}
+
+// RedirectStdLog redirects the output of the stdlib logger to the logger at the level,
+// and the flags and prefix of the stdlib logger are cleared since the logs have their own prefixes.
+// It returns a function to restore the stdlib logger.
+// The lines without a caller outside the stdlib use the location calling RedirectStdLog.
+func RedirectStdLog(logger *CLogger, level Level) (restore func()) {
+	flags, prefix, output := log.Flags(), log.Prefix(), log.Writer()
+	w := newLineWriter(logger, level, nil)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(w)
+	return func() {
+		_ = w.Flush()
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(output)
+	}
+}
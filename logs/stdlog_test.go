@@ -0,0 +1,99 @@
+package logs
+
+import (
+	"log"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// callerLine returns the location of the caller's line with the offset.
+func callerLine(offset int) string {
+	_, _, line, _ := runtime.Caller(1)
+	return "stdlog_test.go:" + strconv.Itoa(line+offset)
+}
+
+func TestLineWriter(t *testing.T) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder))
+	lw := NewLineWriter(logger, WarnLevel, "source", "lib")
+	lw.maxLineSize = 8
+
+	_, _ = lw.Write([]byte("hello\nwor"))
+	loc := callerLine(-1)
+	assert.Equal(t, 1, len(recorder.contents))
+	assert.Regexp(t, `^Warn .* `+loc+` .* source=lib hello$`, recorder.contents[0])
+
+	n, err := lw.Write([]byte("ld\r\n0123456789abcdefg"))
+	loc = callerLine(-1)
+	assert.Nil(t, err)
+	assert.Equal(t, 21, n)
+	assert.Equal(t, 4, len(recorder.contents))
+	// the partial line is joined, and the long lines are split
+	assert.Regexp(t, ` `+loc+` .* source=lib world$`, recorder.contents[1])
+	assert.Regexp(t, ` source=lib 01234567$`, recorder.contents[2])
+	assert.Regexp(t, ` source=lib 89abcdef$`, recorder.contents[3])
+
+	assert.Nil(t, lw.Close())
+	assert.Equal(t, 5, len(recorder.contents))
+	assert.Regexp(t, ` source=lib g$`, recorder.contents[4])
+	assert.Nil(t, lw.Flush())
+	assert.Equal(t, 5, len(recorder.contents))
+
+	logger.SetLevel(ErrorLevel)
+	_, _ = lw.Write([]byte("disabled\n"))
+	assert.Equal(t, 5, len(recorder.contents))
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder))
+	restore := RedirectStdLog(logger, InfoLevel)
+	// the lines without a caller outside the stdlib fall back to the caller of RedirectStdLog
+	assert.Equal(t, callerLine(-2), log.Writer().(*LineWriter).location)
+	log.Printf("from %s", "stdlib")
+	loc := callerLine(-1)
+	log.Print("multiple\nlines")
+	restore()
+
+	assert.Equal(t, 3, len(recorder.contents))
+	assert.Regexp(t, `^Info .* `+loc+` .* from stdlib$`, recorder.contents[0])
+	assert.Regexp(t, ` multiple$`, recorder.contents[1])
+	assert.Regexp(t, ` lines$`, recorder.contents[2])
+	assert.NotEqual(t, 0, log.Flags())
+}
+
+func TestLineWriter_Cmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not found")
+	}
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder))
+	lw := NewLineWriter(logger, InfoLevel, "cmd", "sh")
+	loc := callerLine(-1)
+	cmd := exec.Command("sh", "-c", "echo out; echo err 1>&2")
+	cmd.Stdout = lw
+	cmd.Stderr = lw
+	assert.Nil(t, cmd.Run())
+
+	// the writes from the goroutines of exec.Cmd use the location creating the writer
+	assert.Equal(t, 2, len(recorder.contents))
+	for _, content := range recorder.contents {
+		assert.Regexp(t, ` `+loc+` .* cmd=sh (out|err)$`, content)
+	}
+}
+
+func TestIsLibraryFrame(t *testing.T) {
+	assert.True(t, isLibraryFrame(goroot+"/src/log/log.go", "log.Printf"))
+	// the stdlib files are not under GOROOT with -trimpath
+	assert.True(t, isLibraryFrame("log/log.go", "log.(*Logger).output"))
+	assert.True(t, isLibraryFrame(logsDir+"/stdlog.go", "github.com/erickxeno/clib/logs.(*LineWriter).Write"))
+	assert.True(t, isLibraryFrame(logsDir+"/sloghandler/handler.go", "github.com/erickxeno/clib/logs/sloghandler.(*Handler).Handle"))
+	assert.False(t, isLibraryFrame(logsDir+"/stdlog_test.go", "github.com/erickxeno/clib/logs.TestLineWriter"))
+	// the module paths without a dot are not the stdlib
+	assert.False(t, isLibraryFrame("/src/myservice/internal/db/db.go", "myservice/internal/db.Query"))
+	assert.False(t, isLibraryFrame("/src/myservice/main.go", "main.main"))
+}
@@ -0,0 +1,220 @@
+package logs
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const vmoduleMaxDepth = 16
+
+// logsDir is the directory of this package, the frames in it are skipped to find the call site.
+var logsDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.ToSlash(filepath.Dir(file))
+}()
+
+// goroot is the GOROOT of the binary, the frames in it are the stdlib.
+var goroot = filepath.ToSlash(runtime.GOROOT())
+
+// bridgePackages are the stdlib packages between the user code and the logger in the bridges,
+// e.g. log.Printf reaching LineWriter, they are recognized even if the stdlib is not under goroot like with -trimpath.
+var bridgePackages = map[string]bool{
+	"bufio":    true,
+	"fmt":      true,
+	"io":       true,
+	"log":      true,
+	"log/slog": true,
+	"os/exec":  true,
+}
+
+// isLibraryFrame reports whether the frame is in this package or its sub packages except the tests, or in the stdlib.
+// They are skipped to find the call site in the user code, e.g. the caller of slog.Info through the sloghandler.
+func isLibraryFrame(file, function string) bool {
+	if strings.HasSuffix(file, "_test.go") {
+		return false
+	}
+	if path.Dir(file) == logsDir || strings.HasPrefix(file, logsDir+"/") {
+		return true
+	}
+	if goroot != "" && strings.HasPrefix(file, goroot+"/src/") {
+		return true
+	}
+	return bridgePackages[funcPackage(function)]
+}
+
+type vmoduleRule struct {
+	pattern string
+	// isFile means the pattern is matched with the file path, otherwise with the package path.
+	isFile bool
+	// recursive means the package pattern ends with "/...", which matches the sub packages as well.
+	recursive bool
+	level     Level
+}
+
+type vmoduleSite struct {
+	internal bool // the frame is in the library or the stdlib, go on with the caller
+	matched  bool
+	level    Level
+}
+
+// vmodule is an immutable rule set with a cache of the call sites,
+// the cache is a copy-on-write map so that looking up is lock-free.
+type vmodule struct {
+	rules []vmoduleRule
+	lock  sync.Mutex
+	sites unsafe.Pointer // *map[uintptr]vmoduleSite
+}
+
+// parseVModule parses the rules like "storage/*.go=debug,github.com/foo/bar/...=warn".
+// A pattern containing ".go" is a glob of the file path, e.g. "storage/*.go" or "main.go",
+// otherwise it is a glob of the package path, e.g. "storage", "github.com/foo/*/dao" or "github.com/foo/bar/...".
+// Both of them are matched with the trailing elements of the path, and the first matched rule wins.
+func parseVModule(spec string) (*vmodule, error) {
+	vm := &vmodule{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndexByte(item, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid vmodule rule: %q", item)
+		}
+		level, err := ParseLevel(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vmodule rule: %q: %w", item, err)
+		}
+		rule := vmoduleRule{pattern: strings.Trim(strings.TrimSpace(item[:i]), "/"), level: level}
+		rule.isFile = strings.Contains(rule.pattern, ".go")
+		if !rule.isFile && strings.HasSuffix(rule.pattern, "/...") {
+			rule.pattern = strings.TrimSuffix(rule.pattern, "/...")
+			rule.recursive = true
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid vmodule rule: %q: %w", item, err)
+		}
+		vm.rules = append(vm.rules, rule)
+	}
+	if len(vm.rules) == 0 {
+		return nil, nil
+	}
+	sites := make(map[uintptr]vmoduleSite)
+	vm.sites = unsafe.Pointer(&sites)
+	return vm, nil
+}
+
+// siteLevel returns the level of the rule matching the call site of the logger.
+func (vm *vmodule) siteLevel() (Level, bool) {
+	var pcs [vmoduleMaxDepth]uintptr
+	// skip runtime.Callers, siteLevel and logger.newLog
+	n := runtime.Callers(3, pcs[:])
+	sites := *(*map[uintptr]vmoduleSite)(atomic.LoadPointer(&vm.sites))
+	for _, pc := range pcs[:n] {
+		site, ok := sites[pc]
+		if !ok {
+			site = vm.resolve(pc)
+		}
+		if !site.internal {
+			return site.level, site.matched
+		}
+	}
+	return 0, false
+}
+
+func (vm *vmodule) resolve(pc uintptr) vmoduleSite {
+	site := vmoduleSite{internal: true}
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		file := filepath.ToSlash(frame.File)
+		if !isLibraryFrame(file, frame.Function) {
+			site = vm.match(file, funcPackage(frame.Function))
+			break
+		}
+		if !more {
+			break
+		}
+	}
+
+	vm.lock.Lock()
+	defer vm.lock.Unlock()
+	sites := *(*map[uintptr]vmoduleSite)(atomic.LoadPointer(&vm.sites))
+	newSites := make(map[uintptr]vmoduleSite, len(sites)+1)
+	for k, v := range sites {
+		newSites[k] = v
+	}
+	newSites[pc] = site
+	atomic.StorePointer(&vm.sites, unsafe.Pointer(&newSites))
+	return site
+}
+
+func (vm *vmodule) match(file, pkg string) vmoduleSite {
+	for _, rule := range vm.rules {
+		var matched bool
+		if rule.isFile {
+			matched = matchPathSuffix(rule.pattern, file)
+		} else {
+			matched = matchPathSuffix(rule.pattern, pkg)
+			for p := pkg; !matched && rule.recursive && strings.Contains(p, "/"); {
+				p = path.Dir(p)
+				matched = matchPathSuffix(rule.pattern, p)
+			}
+		}
+		if matched {
+			return vmoduleSite{matched: true, level: rule.level}
+		}
+	}
+	return vmoduleSite{}
+}
+
+// matchPathSuffix matches the pattern with the trailing elements of the path,
+// e.g. "storage/*.go" matches "/home/foo/project/storage/db.go".
+func matchPathSuffix(pattern, name string) bool {
+	n := strings.Count(pattern, "/") + 1
+	i := len(name)
+	for ; n > 0 && i >= 0; n-- {
+		i = strings.LastIndexByte(name[:i], '/')
+	}
+	if n > 0 {
+		// the path has less elements than the pattern
+		return false
+	}
+	matched, _ := path.Match(pattern, name[i+1:])
+	return matched
+}
+
+// funcPackage returns the package path of the function name like "github.com/foo/bar.(*T).Method".
+func funcPackage(funcName string) string {
+	slash := strings.LastIndexByte(funcName, '/')
+	if dot := strings.IndexByte(funcName[slash+1:], '.'); dot >= 0 {
+		return funcName[:slash+1+dot]
+	}
+	return funcName
+}
+
+// SetVModule sets the per-file or per-package levels of the logger at runtime,
+// e.g. "storage/*.go=debug,github.com/foo/bar/...=warn", see parseVModule for the patterns.
+// The level of the matched call site is used instead of the logger's level, while the writers' levels still apply,
+// e.g. a Debug log of a matched site is not written to a Warn writer.
+// The call site is the first frame out of this module and the stdlib, so the logs bridged by the sloghandler,
+// LineWriter or httplog are matched with the user code calling them, and no rule matches if there is none,
+// e.g. the access logs printed by the server middleware in the net/http goroutines.
+// An empty spec removes all the rules.
+func (l *logger) SetVModule(spec string) error {
+	vm, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+	atomic.StorePointer(&l.vmodule, unsafe.Pointer(vm))
+	return nil
+}
+
+func (l *logger) getVModule() *vmodule {
+	return (*vmodule)(atomic.LoadPointer(&l.vmodule))
+}
@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVModule_Level(t *testing.T) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(TraceLevel, recorder), WithVModule("storage/*.go=debug, vmodule_test.go=trace"))
+	logger.SetLevel(InfoLevel)
+
+	logger.Trace().Str("trace").Emit()
+	assert.Equal(t, 1, len(recorder.contents))
+	assert.Contains(t, recorder.last(), "trace")
+
+	// the compatible logger has the same call site
+	compat := NewCompatLoggerFrom(logger)
+	compat.Debug("debug %d", 1)
+	assert.Equal(t, 2, len(recorder.contents))
+	assert.Contains(t, recorder.last(), "debug 1")
+
+	// raise the level at runtime
+	assert.Nil(t, logger.SetVModule("logs=warn"))
+	logger.Info().Str("info").Emit()
+	assert.Equal(t, 2, len(recorder.contents))
+	logger.Warn().Str("warn").Emit()
+	assert.Equal(t, 3, len(recorder.contents))
+
+	assert.Nil(t, logger.SetVModule("github.com/erickxeno/...=debug"))
+	logger.Debug().Str("debug").Emit()
+	assert.Equal(t, 4, len(recorder.contents))
+
+	// no rule matches
+	assert.Nil(t, logger.SetVModule("storage/*.go=debug,github.com/foo/logs=trace"))
+	logger.Debug().Str("debug").Emit()
+	assert.Equal(t, 4, len(recorder.contents))
+
+	assert.Nil(t, logger.SetVModule(""))
+	assert.Nil(t, logger.getVModule())
+	logger.Debug().Str("debug").Emit()
+	assert.Equal(t, 4, len(recorder.contents))
+}
+
+func TestVModule_WriterLevels(t *testing.T) {
+	infoRecorder, warnRecorder := &contentRecorder{}, &contentRecorder{}
+	logger := NewCLogger(SetWriter(InfoLevel, infoRecorder), AppendWriter(WarnLevel, warnRecorder), WithVModule("vmodule_test.go=info"))
+	logger.SetLevel(ErrorLevel)
+
+	// the matched site lowers the threshold of the logger, but not the levels of the writers
+	logger.Info().Str("info").Emit()
+	logger.Debug().Str("debug").Emit()
+	assert.Equal(t, 1, len(infoRecorder.contents))
+	assert.Contains(t, infoRecorder.last(), "info")
+	assert.Equal(t, 0, len(warnRecorder.contents))
+
+	// the unmatched sites keep the level of the logger
+	assert.Nil(t, logger.SetVModule("storage/*.go=info"))
+	logger.Warn().Str("warn").Emit()
+	assert.Equal(t, 1, len(infoRecorder.contents))
+	assert.Equal(t, 0, len(warnRecorder.contents))
+}
+
+func TestVModule_Bridge(t *testing.T) {
+	recorder := &contentRecorder{}
+	logger := NewCLogger(SetWriter(DebugLevel, recorder), WithVModule("vmodule_test.go=debug"))
+	logger.SetLevel(InfoLevel)
+
+	// the call site is the caller of the stdlib logger, not the LineWriter
+	stdLogger := log.New(NewLineWriter(logger, DebugLevel), "", 0)
+	stdLogger.Printf("bridged %d", 1)
+	assert.Equal(t, 1, len(recorder.contents))
+	assert.Contains(t, recorder.last(), "bridged 1")
+
+	assert.Nil(t, logger.SetVModule("stdlog.go=debug"))
+	stdLogger.Printf("bridged %d", 2)
+	assert.Equal(t, 1, len(recorder.contents))
+}
+
+func TestVModule_Invalid(t *testing.T) {
+	logger := NewCLogger()
+	assert.NotNil(t, logger.SetVModule("storage"))
+	assert.NotNil(t, logger.SetVModule("storage=verbose"))
+	assert.NotNil(t, logger.SetVModule("[storage=debug"))
+	assert.Panics(t, func() { NewCLogger(WithVModule("=debug")) })
+}
+
+func TestVModule_Allocs(t *testing.T) {
+	logger := NewCLogger(SetWriter(InfoLevel, &contentRecorder{}), WithVModule("storage/*.go=debug"))
+	logger.Debug().Str("warm up").Emit()
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Debug().Str("dropped").Emit()
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestMatchPathSuffix(t *testing.T) {
+	assert.True(t, matchPathSuffix("storage/*.go", "/home/foo/project/storage/db.go"))
+	assert.True(t, matchPathSuffix("storage/*.go", "storage/db.go"))
+	assert.True(t, matchPathSuffix("db.go", "/home/foo/project/storage/db.go"))
+	assert.False(t, matchPathSuffix("storage/*.go", "/home/foo/project/storage/db/db.go"))
+	assert.False(t, matchPathSuffix("storage/*.go", "db.go"))
+	assert.True(t, matchPathSuffix("github.com/foo/*/dao", "github.com/foo/bar/dao"))
+	assert.False(t, matchPathSuffix("dao", "github.com/foo/bar/dao/mysql"))
+}
+
+func TestFuncPackage(t *testing.T) {
+	assert.Equal(t, "github.com/foo/bar", funcPackage("github.com/foo/bar.(*T).Method"))
+	assert.Equal(t, "github.com/foo/bar", funcPackage("github.com/foo/bar.Func.func1"))
+	assert.Equal(t, "main", funcPackage("main.main"))
+}
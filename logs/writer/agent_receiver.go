@@ -0,0 +1,249 @@
+package writer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	osTime "time"
+)
+
+var ErrInvalidAgentFrame = errors.New("invalid agent frame")
+
+// AgentRecord is a log decoded from the frames sent by AgentWriter.
+type AgentRecord struct {
+	Level    string
+	Time     osTime.Time
+	Location string
+	LogID    string
+	SpanID   uint64
+	PSM      string
+	Message  string
+	// KVs keeps the typed key-values added by the user, they are not pooled and should not be recycled.
+	KVs []*KeyValue
+}
+
+// AgentReceiver is a reference implementation of the log agent,
+// it accepts the connections from AgentWriter and decodes the frames.
+// It is useful to run locally and in tests.
+type AgentReceiver struct {
+	listener net.Listener
+	handler  func(records []*AgentRecord)
+	conns    map[net.Conn]struct{}
+	lock     sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// NewAgentReceiver listens on the unix domain socket, the stale socket file is removed,
+// handler is called with the records of each frame, it may be called concurrently by different connections.
+func NewAgentReceiver(socketPath string, handler func(records []*AgentRecord)) (*AgentReceiver, error) {
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return &AgentReceiver{
+		listener: listener,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections until the receiver is closed.
+func (r *AgentReceiver) Serve() error {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		r.lock.Lock()
+		r.conns[conn] = struct{}{}
+		r.lock.Unlock()
+		r.wg.Add(1)
+		go r.serveConn(conn)
+	}
+}
+
+func (r *AgentReceiver) serveConn(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.lock.Lock()
+		delete(r.conns, conn)
+		r.lock.Unlock()
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReaderSize(conn, oneMessageLimitByte)
+	var buf []byte
+	for {
+		var records []*AgentRecord
+		var err error
+		records, buf, err = ReadAgentFrame(reader, buf)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				_, _ = fmt.Fprintf(os.Stderr, "log agent receiver reads error: %s\n", err)
+			}
+			return
+		}
+		r.handler(records)
+	}
+}
+
+// Close stops accepting and closes all the connections.
+func (r *AgentReceiver) Close() error {
+	err := r.listener.Close()
+	r.lock.Lock()
+	for conn := range r.conns {
+		_ = conn.Close()
+	}
+	r.lock.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+// ReadAgentFrame reads a frame from reader and decodes it, buf is reused to read the frame and returned for next reading.
+func ReadAgentFrame(reader io.Reader, buf []byte) ([]*AgentRecord, []byte, error) {
+	if cap(buf) < agentFrameHeaderSize {
+		buf = make([]byte, agentFrameHeaderSize, oneMessageLimitByte)
+	}
+	buf = buf[:agentFrameHeaderSize]
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, buf, err
+	}
+	if string(buf[:4]) != agentFrameMagic {
+		return nil, buf, ErrInvalidAgentFrame
+	}
+	length, _ := DecodeUint32(buf[4:])
+	if length < 4 || agentFrameHeaderSize+int(length)-4 > oneMessageLimitByte {
+		return nil, buf, ErrInvalidAgentFrame
+	}
+	size := agentFrameHeaderSize + int(length) - 4
+	if cap(buf) < size {
+		newBuf := make([]byte, size)
+		copy(newBuf, buf)
+		buf = newBuf
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(reader, buf[agentFrameHeaderSize:]); err != nil {
+		return nil, buf, err
+	}
+	records, err := DecodeAgentFrame(buf)
+	return records, buf, err
+}
+
+// DecodeAgentFrame decodes a whole frame including the header.
+func DecodeAgentFrame(frame []byte) ([]*AgentRecord, error) {
+	if len(frame) < agentFrameHeaderSize || string(frame[:4]) != agentFrameMagic {
+		return nil, ErrInvalidAgentFrame
+	}
+	length, _ := DecodeUint32(frame[4:])
+	count, _ := DecodeUint32(frame[8:])
+	if int(length)+8 != len(frame) || count > oneMessageLimitLogNumber {
+		return nil, ErrInvalidAgentFrame
+	}
+	records := make([]*AgentRecord, 0, count)
+	pos := agentFrameHeaderSize
+	for i := 0; i < int(count); i++ {
+		recordLen, _, err := decodeUint32(frame, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos += agentRecordLenSize
+		end := pos + int(recordLen)
+		if end > len(frame) {
+			return nil, ErrNoEnoughBytes
+		}
+		record, err := decodeAgentRecord(frame[pos:end])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		pos = end
+	}
+	if pos != len(frame) {
+		return nil, ErrInvalidAgentFrame
+	}
+	return records, nil
+}
+
+func decodeAgentRecord(data []byte) (*AgentRecord, error) {
+	record := &AgentRecord{}
+	pos := 0
+	for pos < len(data) {
+		key, l, err := decodeValueWithUnknownType(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, ErrInvalidAgentFrame
+		}
+		pos += l
+		kv, l, err := decodeAgentValue(keyStr, data, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos += l
+		switch keyStr {
+		case AgentLevelKey:
+			record.Level = string(kv.Value)
+		case AgentTsKey:
+			ts, _ := DecodeUint64(kv.Value)
+			record.Time = osTime.Unix(0, int64(ts)*int64(osTime.Millisecond))
+		case AgentLocationKey:
+			record.Location = string(kv.Value)
+		case AgentLogIDKey:
+			record.LogID = string(kv.Value)
+		case AgentSpanIDKey:
+			record.SpanID, _ = DecodeUint64(kv.Value)
+		case AgentPSMKey:
+			record.PSM = string(kv.Value)
+		case AgentMsgKey:
+			record.Message = string(kv.Value)
+		default:
+			record.KVs = append(record.KVs, kv)
+		}
+	}
+	return record, nil
+}
+
+// decodeAgentValue decodes a typed value and keeps the raw bytes like KeyValue does.
+func decodeAgentValue(key string, data []byte, offset int) (*KeyValue, int, error) {
+	valueType, l, err := decodeByteRaw(data, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += l
+	var value []byte
+	var readLength int
+	switch valueType {
+	case StringType:
+		var s string
+		s, readLength, err = decodeShortStr(data, offset)
+		value = []byte(s)
+	case TextType:
+		var s string
+		s, readLength, err = decodeLongStr(data, offset)
+		value = []byte(s)
+	case BytesType:
+		value, readLength, err = decodeBytes(data, offset)
+		value = append([]byte(nil), value...)
+	default:
+		readLength, err = decodeValueLengthWithType(data, offset, valueType)
+		if err == nil && offset+readLength > len(data) {
+			err = ErrNoEnoughBytes
+		}
+		if err == nil {
+			value = append([]byte(nil), data[offset:offset+readLength]...)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &KeyValue{Key: key, Value: value, ValueType: valueType}, readLength + l, nil
+}
@@ -1,15 +1,16 @@
 package writer
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"sync"
-	//	"sync/atomic"
-	//	"unsafe"
-	//
-	//	"/gopkg/env"
-	//	"/log_market/gosdk"
-	//	agent "/log_market/ttlogagent_gosdk"
+	"sync/atomic"
+	osTime "time"
+
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -17,58 +18,340 @@ const (
 	traceVersion = "v1(6)"
 )
 
-// AgentWriter provides a way to print the log to log service:
-// https://site.bytedance.net/docs/2294/5919/log_overview/,
-// it boxes the log to protobuf message and output to a unix domain socket,
-// to be mentioned that the AgentWriter is asynchronous currently,
+// The frame sent by AgentWriter, all the integers are little endian:
+//
+//	| magic "SLOG" | payload length uint32 | log count uint32 | records |
+//
+// the payload contains the log count and the records, each record is:
+//
+//	| record length uint32 | key-value pairs encoded by EncodeKeyValue |
+//
+// a frame is not larger than 128KB and contains at most 4096 logs.
+const (
+	agentFrameMagic      = "SLOG"
+	agentFrameHeaderSize = 12
+	agentRecordLenSize   = 4
+
+	AgentLevelKey    = "_level"
+	AgentTsKey       = "_ts"
+	AgentLocationKey = "_location"
+	AgentLogIDKey    = "_logid"
+	AgentSpanIDKey   = "_spanid"
+	AgentPSMKey      = "_psm"
+	AgentMsgKey      = "_msg"
+)
+
+const (
+	DefaultAgentSocketPath = "/var/run/clib/log_agent.sock"
+
+	defaultAgentQueueSize      = 4096
+	defaultAgentFlushInterval  = 100 * osTime.Millisecond
+	defaultAgentEnqueueTimeout = 10 * osTime.Millisecond
+	agentDialTimeout           = 100 * osTime.Millisecond
+	agentWriteTimeout          = osTime.Second
+	agentMinReconnectBackoff   = 100 * osTime.Millisecond
+	agentMaxReconnectBackoff   = 10 * osTime.Second
+)
+
+var (
+	ErrAgentQueueFull    = errors.New("agent writer queue is full")
+	ErrAgentFlushTimeout = errors.New("agent writer flush timeout")
+)
+
+// AgentWriter provides a way to send the log to a local log agent,
+// it batches the logs into frames and sends them to a unix domain socket,
+// to be mentioned that the AgentWriter is asynchronous,
 // it does not need to be wrapped with AsyncWriter.
+//
+// The sender is started by the first log, logs are dropped silently if the agent is not connected,
+// and the writer reconnects to the agent with an exponential backoff.
+// If the agent is connected but slow, Write blocks for the enqueue timeout at most and then drops the log.
 type AgentWriter struct {
 	sync.Once
-	//sender *agent.LogSender
+	socketPath     string
+	queueSize      int
+	flushInterval  osTime.Duration
+	enqueueTimeout osTime.Duration
+
+	queue      chan Packet
+	flushReq   chan chan struct{}
+	done       chan struct{}
+	background sync.WaitGroup
+	started    int32
+	closed     int32
+	connected  int32
+	dropped    uint64
+
+	conn       net.Conn
+	nextDial   osTime.Time
+	backoff    osTime.Duration
+	errorPrint *rate.Limiter
 }
 
 // NewAgentWriter creates a AgentWriter.
-func NewAgentWriter() LogWriter {
-	return &AgentWriter{
-		//sender: nil,
+func NewAgentWriter(options ...AgentOption) LogWriter {
+	w := &AgentWriter{
+		socketPath:     DefaultAgentSocketPath,
+		queueSize:      defaultAgentQueueSize,
+		flushInterval:  defaultAgentFlushInterval,
+		enqueueTimeout: defaultAgentEnqueueTimeout,
+		flushReq:       make(chan chan struct{}),
+		done:           make(chan struct{}),
+		backoff:        agentMinReconnectBackoff,
+		errorPrint:     rate.NewLimiter(rate.Every(osTime.Second), 1),
+	}
+	for _, op := range options {
+		op(w)
 	}
+	w.queue = make(chan Packet, w.queueSize)
+	return w
+}
+
+func (w *AgentWriter) start() {
+	w.background.Add(1)
+	go w.runSender()
+	atomic.StoreInt32(&w.started, 1)
+}
+
+// Dropped returns the count of the logs dropped since the writer is created.
+func (w *AgentWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
 }
 
 func (w *AgentWriter) Close() error {
-	//senderPtr := unsafe.Pointer(w.sender)
-	//if atomic.LoadPointer(&senderPtr) != nil {
-	//	w.sender.Exit()
-	//}
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return nil
+	}
+	if atomic.LoadInt32(&w.started) == 0 {
+		return nil
+	}
+	close(w.done)
+	// try best to send the logs in the queue, exit if it cannot finish in 1 second.
+	waitChan := make(chan bool, 1)
+	go func() {
+		w.background.Wait()
+		waitChan <- true
+	}()
+	select {
+	case <-waitChan:
+		if w.conn != nil {
+			return w.conn.Close()
+		}
+	case <-osTime.After(closeTimeout):
+	}
 	return nil
 }
 
 func (w *AgentWriter) Write(log RecyclableLog) error {
-	w.Once.Do(func() {
-		//sender := agent.NewLogSenderByName(deepCopyStr(log.GetPSM()))
-		//sender.Start()
-		//w.sender = sender
-	})
-	// TODO: the Logagent SDK only supports async sending, use sync sending instead
 	defer log.Recycle()
-	//header := &agent.MsgV3Header{
-	//	Level:    log.GetLevel(),
-	//	Location: log.GetLine(),
-	//	LogID:    logIDFromContext(log.GetContext()),
-	//	Ts:       log.GetTime().UnixNano() / 1e6,
-	//	SpanID:   spanIDFromContext(log.GetContext()),
-	//}
-	//// TODO: refactor agent client and avoid this malloc
-	//bodyData := log.GetBody()
-	//data := make([]byte, len(bodyData))
-	//copy(data, bodyData)
-	//msg := agent.NewMsgV3(data, header, log.GetKVListStr()...)
-	//return w.sender.Send(msg)
-	return nil
+	if atomic.LoadInt32(&w.closed) == 1 {
+		atomic.AddUint64(&w.dropped, 1)
+		return nil
+	}
+	w.Once.Do(w.start)
+
+	record := NewPacket(0)
+	*record = encodeAgentRecord(*record, log)
+	select {
+	case w.queue <- record:
+		return nil
+	default:
+	}
+	if atomic.LoadInt32(&w.connected) == 0 {
+		// the agent is not available, do not block the user.
+		PutPacket(record)
+		atomic.AddUint64(&w.dropped, 1)
+		return nil
+	}
+	timer := osTime.NewTimer(w.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- record:
+		return nil
+	case <-timer.C:
+		PutPacket(record)
+		atomic.AddUint64(&w.dropped, 1)
+		return ErrAgentQueueFull
+	}
 }
 
+// Flush sends the logs in the queue to the agent, it waits for 1 second at most.
 func (w *AgentWriter) Flush() error {
-	// TODO: unsupported currently
-	return nil
+	if atomic.LoadInt32(&w.started) == 0 || atomic.LoadInt32(&w.closed) == 1 {
+		return nil
+	}
+	ack := make(chan struct{})
+	timer := osTime.NewTimer(closeTimeout)
+	defer timer.Stop()
+	select {
+	case w.flushReq <- ack:
+	case <-timer.C:
+		return ErrAgentFlushTimeout
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-timer.C:
+		return ErrAgentFlushTimeout
+	}
+}
+
+func (w *AgentWriter) runSender() {
+	defer w.background.Done()
+	ticker := osTime.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	frame := make([]byte, agentFrameHeaderSize, oneMessageLimitByte)
+	count := 0
+	drain := func() {
+		for i := len(w.queue); i > 0; i-- {
+			frame, count = w.appendRecord(frame, count, <-w.queue)
+		}
+		frame, count = w.sendFrame(frame, count)
+	}
+	for {
+		select {
+		case record := <-w.queue:
+			frame, count = w.appendRecord(frame, count, record)
+		case <-ticker.C:
+			frame, count = w.sendFrame(frame, count)
+		case ack := <-w.flushReq:
+			drain()
+			close(ack)
+		case <-w.done:
+			drain()
+			return
+		}
+	}
+}
+
+// appendRecord appends the record to the frame, the frame is sent first if it reaches the limits.
+func (w *AgentWriter) appendRecord(frame []byte, count int, record Packet) ([]byte, int) {
+	defer PutPacket(record)
+	size := agentRecordLenSize + len(*record)
+	if agentFrameHeaderSize+size > oneMessageLimitByte {
+		atomic.AddUint64(&w.dropped, 1)
+		if w.errorPrint.Allow() {
+			_, _ = fmt.Fprintf(os.Stderr, "log agent writer drops a log of %d bytes which exceeds the frame limit\n", size)
+		}
+		return frame, count
+	}
+	if len(frame)+size > oneMessageLimitByte || count >= oneMessageLimitLogNumber {
+		frame, count = w.sendFrame(frame, count)
+	}
+	frame = EncodeUint32(frame, uint32(len(*record)))
+	frame = append(frame, *record...)
+	return frame, count + 1
+}
+
+// sendFrame sends the frame to the agent and returns the reset frame,
+// the frame is dropped if the agent is not available.
+func (w *AgentWriter) sendFrame(frame []byte, count int) ([]byte, int) {
+	if count == 0 {
+		return frame, 0
+	}
+	copy(frame, agentFrameMagic)
+	WriteUint32(frame, 4, uint32(len(frame)-8))
+	WriteUint32(frame, 8, uint32(count))
+	// retry once with a new connection since the agent may be restarted.
+	var err error
+	for i := 0; i < 2; i++ {
+		if !w.connect() {
+			break
+		}
+		_ = w.conn.SetWriteDeadline(osTime.Now().Add(agentWriteTimeout))
+		if _, err = w.conn.Write(frame); err == nil {
+			return frame[:agentFrameHeaderSize], 0
+		}
+		w.disconnect()
+	}
+	if err != nil && w.errorPrint.Allow() {
+		_, _ = fmt.Fprintf(os.Stderr, "log agent writer sends error: %s\n", err)
+	}
+	atomic.AddUint64(&w.dropped, uint64(count))
+	return frame[:agentFrameHeaderSize], 0
+}
+
+// connect dials the agent if it is not connected, it backs off exponentially after failures.
+func (w *AgentWriter) connect() bool {
+	if w.conn != nil {
+		return true
+	}
+	now := osTime.Now()
+	if now.Before(w.nextDial) {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", w.socketPath, agentDialTimeout)
+	if err != nil {
+		// the agent may not be deployed, the failure is not printed.
+		w.nextDial = now.Add(w.backoff)
+		w.backoff *= 2
+		if w.backoff > agentMaxReconnectBackoff {
+			w.backoff = agentMaxReconnectBackoff
+		}
+		return false
+	}
+	w.conn = conn
+	w.backoff = agentMinReconnectBackoff
+	atomic.StoreInt32(&w.connected, 1)
+	return true
+}
+
+func (w *AgentWriter) disconnect() {
+	_ = w.conn.Close()
+	w.conn = nil
+	atomic.StoreInt32(&w.connected, 0)
+}
+
+// encodeAgentRecord encodes the log to a frame record without the length prefix.
+func encodeAgentRecord(buf []byte, log StructuredLog) []byte {
+	ctx := log.GetContext()
+	buf = EncodeKeyValueStr(buf, AgentLevelKey, log.GetLevel())
+	buf = EncodeKeyValueUint64(buf, AgentTsKey, uint64(log.GetTime().UnixNano()/1e6))
+	buf = EncodeKeyValueStr(buf, AgentLocationKey, SliceByteToString(log.GetLocation()))
+	buf = EncodeKeyValueStr(buf, AgentLogIDKey, logIDFromContext(ctx))
+	buf = EncodeKeyValueUint64(buf, AgentSpanIDKey, spanIDFromContext(ctx))
+	buf = EncodeKeyValueStr(buf, AgentPSMKey, log.GetPSM())
+	buf = EncodeKeyValueText(buf, AgentMsgKey, SliceByteToString(log.GetBody()))
+	for _, kv := range log.GetKVList() {
+		buf = EncodeKeyValue(buf, kv.Key, kv.Value, kv.ValueType)
+	}
+	return buf
+}
+
+type AgentOption func(*AgentWriter)
+
+// SetAgentSocketPath sets the unix domain socket path of the agent, the default is DefaultAgentSocketPath.
+func SetAgentSocketPath(path string) AgentOption {
+	return func(writer *AgentWriter) {
+		writer.socketPath = path
+	}
+}
+
+// SetAgentQueueSize sets the count of logs could be queued before sending, the default is 4096.
+func SetAgentQueueSize(size int) AgentOption {
+	return func(writer *AgentWriter) {
+		if size > 0 {
+			writer.queueSize = size
+		}
+	}
+}
+
+// SetAgentFlushInterval sets the max interval to send a frame which is not full, the default is 100ms.
+func SetAgentFlushInterval(interval osTime.Duration) AgentOption {
+	return func(writer *AgentWriter) {
+		if interval > 0 {
+			writer.flushInterval = interval
+		}
+	}
+}
+
+// SetAgentEnqueueTimeout sets how long Write blocks if the queue is full while the agent is connected,
+// the log is dropped after the timeout, the default is 10ms.
+func SetAgentEnqueueTimeout(timeout osTime.Duration) AgentOption {
+	return func(writer *AgentWriter) {
+		writer.enqueueTimeout = timeout
+	}
 }
 
 type TraceAgentWriter struct {
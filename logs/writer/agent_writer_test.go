@@ -0,0 +1,136 @@
+package writer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type agentCollector struct {
+	sync.Mutex
+	records []*AgentRecord
+	frames  int
+	maxLogs int
+}
+
+func (c *agentCollector) handle(records []*AgentRecord) {
+	c.Lock()
+	defer c.Unlock()
+	c.records = append(c.records, records...)
+	c.frames++
+	if len(records) > c.maxLogs {
+		c.maxLogs = len(records)
+	}
+}
+
+func (c *agentCollector) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.records)
+}
+
+func startAgentReceiver(t *testing.T, socketPath string) (*AgentReceiver, *agentCollector) {
+	c := &agentCollector{}
+	r, err := NewAgentReceiver(socketPath, c.handle)
+	assert.Nil(t, err)
+	go func() { _ = r.Serve() }()
+	return r, c
+}
+
+func TestAgentWriter_Roundtrip(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	r, c := startAgentReceiver(t, socketPath)
+	defer r.Close()
+
+	w := NewAgentWriter(SetAgentSocketPath(socketPath))
+	ctx := context.WithValue(context.Background(), ContextLogIDKey, "1111")
+	ctx = context.WithValue(ctx, ContextSpanIDKey, uint64(123456))
+	for i := 0; i < 10; i++ {
+		log := newTestLog("Info", "hello", NewOmniKeyValue("i", i), NewOmniKeyValue("ok", true), NewOmniKeyValue("s", "v"))
+		log.ctx = ctx
+		assert.Nil(t, w.Write(log))
+		assert.Equal(t, 1, log.recycled)
+	}
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.Close())
+	assert.Eventually(t, func() bool { return c.count() == 10 }, 5*osTime.Second, 10*osTime.Millisecond)
+
+	record := c.records[3]
+	assert.Equal(t, "Info", record.Level)
+	assert.Equal(t, "write_test.go:42", record.Location)
+	assert.Equal(t, "1111", record.LogID)
+	assert.Equal(t, uint64(123456), record.SpanID)
+	assert.Equal(t, "test.psm", record.PSM)
+	assert.Equal(t, "hello", record.Message)
+	assert.WithinDuration(t, osTime.Now(), record.Time, osTime.Minute)
+	assert.Equal(t, 3, len(record.KVs))
+	assert.Equal(t, "i=3", record.KVs[0].String())
+	assert.Equal(t, LongType, record.KVs[0].ValueType)
+	assert.Equal(t, "ok=true", record.KVs[1].String())
+	assert.Equal(t, "s=v", record.KVs[2].String())
+	assert.Equal(t, uint64(0), w.(*AgentWriter).Dropped())
+}
+
+func TestAgentWriter_FrameLimits(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	r, c := startAgentReceiver(t, socketPath)
+	defer r.Close()
+
+	w := NewAgentWriter(SetAgentSocketPath(socketPath), SetAgentQueueSize(10000), SetAgentFlushInterval(osTime.Hour))
+	for i := 0; i < 5000; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "x")))
+	}
+	assert.Nil(t, w.Flush())
+	// frames are limited by the size, the receiver rejects the frame larger than 128KB.
+	body := strings.Repeat("y", 1000)
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", body)))
+	}
+	// a log larger than the frame is dropped.
+	assert.Nil(t, w.Write(newTestLog("Info", strings.Repeat("z", oneMessageLimitByte))))
+	assert.Nil(t, w.Close())
+
+	assert.Eventually(t, func() bool { return c.count() == 5500 }, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.LessOrEqual(t, c.maxLogs, oneMessageLimitLogNumber)
+	assert.Less(t, 3, c.frames)
+	assert.Equal(t, uint64(1), w.(*AgentWriter).Dropped())
+}
+
+func TestAgentWriter_Reconnect(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	w := NewAgentWriter(SetAgentSocketPath(socketPath), SetAgentQueueSize(16), SetAgentFlushInterval(10*osTime.Millisecond))
+	defer w.Close()
+
+	// logs are dropped without blocking if the agent is not available.
+	start := osTime.Now()
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "dropped")))
+	}
+	assert.Less(t, osTime.Since(start), osTime.Second)
+	assert.Nil(t, w.Flush())
+	assert.Less(t, uint64(0), w.(*AgentWriter).Dropped())
+
+	waitReceived := func(c *agentCollector, n int) {
+		assert.Eventually(t, func() bool {
+			if c.count() >= n {
+				return true
+			}
+			assert.Nil(t, w.Write(newTestLog("Info", "retry")))
+			return false
+		}, 5*osTime.Second, 50*osTime.Millisecond)
+	}
+
+	r, c := startAgentReceiver(t, socketPath)
+	waitReceived(c, 1)
+	assert.Nil(t, r.Close())
+
+	// the agent restarts
+	r, c = startAgentReceiver(t, socketPath)
+	defer r.Close()
+	waitReceived(c, 1)
+}
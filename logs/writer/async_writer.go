@@ -4,54 +4,133 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	osTime "time"
 
 	"golang.org/x/time/rate"
 )
 
-const closeTimeout = osTime.Second
+const (
+	closeTimeout = osTime.Second
+
+	defaultAsyncChanSize     = 1024
+	defaultAsyncBlockTimeout = 10 * osTime.Millisecond
+	defaultAsyncBatchSize    = 128
+)
+
+// OverflowPolicy decides what AsyncWriter does if the buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the user goroutine until the buffer is available.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowBlockTimeout blocks the user goroutine for the block timeout at most and drops the log after it.
+	OverflowBlockTimeout
+	// OverflowDropNewest drops the log being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest log in the buffer to make room for the log being written.
+	OverflowDropOldest
+	// OverflowDropBelowLevel drops the log whose level is lower than the drop level,
+	// and blocks the user goroutine for the others, e.g. keeps Warn and higher logs.
+	OverflowDropBelowLevel
+)
+
+// levelOrders is the order of the level names, it is used to compare levels in writers.
+var levelOrders = map[string]int{
+	"Trace":  0,
+	"Debug":  1,
+	"Info":   2,
+	"Notice": 3,
+	"Warn":   4,
+	"Error":  5,
+	"Fatal":  6,
+}
+
+// AsyncStats is the statistics of AsyncWriter, the counts are accumulated since the writer is created.
+type AsyncStats struct {
+	Enqueued          uint64
+	Written           uint64
+	WriteErrors       uint64
+	DroppedNewest     uint64
+	DroppedOldest     uint64
+	DroppedTimeout    uint64
+	DroppedBelowLevel uint64
+	QueueDepth        int
+}
+
+// Dropped returns the count of dropped logs for all reasons.
+func (s AsyncStats) Dropped() uint64 {
+	return s.DroppedNewest + s.DroppedOldest + s.DroppedTimeout + s.DroppedBelowLevel
+}
 
 // AsyncWriter provides a asynchronous wrapper to another writer,
 // it is useful to wrap another blocking writer like FileWriter,
 // to the side chain and avoid some overheads in user thread.
+// If the writer implements BatchWriter, the worker drains up to batch size logs
+// or waits for the batch wait at most per WriteBatch call.
 type AsyncWriter struct {
 	LogWriter
-	done       *sync.WaitGroup
-	ch         chan RecyclableLog
-	flush      chan bool
-	flushed    chan error
-	omit       bool
-	errorPrint *rate.Limiter
+	batchWriter  BatchWriter
+	batch        []RecyclableLog
+	batchSize    int
+	batchWait    osTime.Duration
+	done         *sync.WaitGroup
+	ch           chan RecyclableLog
+	flush        chan bool
+	flushed      chan error
+	chanSize     int
+	policy       OverflowPolicy
+	blockTimeout osTime.Duration
+	dropLevel    int
+	errorPrint   *rate.Limiter
+
+	enqueued          uint64
+	written           uint64
+	writeErrors       uint64
+	droppedNewest     uint64
+	droppedOldest     uint64
+	droppedTimeout    uint64
+	droppedBelowLevel uint64
 }
 
 // NewAsyncWriter creates a AsyncWriter,
 // omit allows AsyncWriter omits the log if the buffer is full or not.
 func NewAsyncWriter(w LogWriter, omit bool) LogWriter {
-	asyncWriter := &AsyncWriter{
-		LogWriter:  w,
-		done:       &sync.WaitGroup{},
-		ch:         make(chan RecyclableLog, 1024),
-		flush:      make(chan bool),
-		flushed:    make(chan error),
-		omit:       omit,
-		errorPrint: rate.NewLimiter(rate.Every(osTime.Second), 1),
-	}
-	go asyncWriter.runWorker()
-	return asyncWriter
+	return NewAsyncWriterWithChanLen(w, defaultAsyncChanSize, omit)
 }
 
 // NewAsyncWriterWithChanLen creates a AsyncWriter,
 // chanLen is the length of ch,
 // omit allows AsyncWriter omits the log if the buffer is full or not.
 func NewAsyncWriterWithChanLen(w LogWriter, chanSize int, omit bool) LogWriter {
+	policy := OverflowBlock
+	if omit {
+		policy = OverflowDropNewest
+	}
+	return NewAsyncWriterWithOptions(w, SetAsyncChanSize(chanSize), SetOverflowPolicy(policy))
+}
+
+// NewAsyncWriterWithOptions creates a AsyncWriter, it drops the newest log if the buffer is full by default.
+func NewAsyncWriterWithOptions(w LogWriter, options ...AsyncOption) LogWriter {
 	asyncWriter := &AsyncWriter{
-		LogWriter:  w,
-		done:       &sync.WaitGroup{},
-		ch:         make(chan RecyclableLog, chanSize),
-		flush:      make(chan bool),
-		flushed:    make(chan error),
-		omit:       omit,
-		errorPrint: rate.NewLimiter(rate.Every(osTime.Second), 1),
+		LogWriter:    w,
+		done:         &sync.WaitGroup{},
+		flush:        make(chan bool),
+		flushed:      make(chan error),
+		chanSize:     defaultAsyncChanSize,
+		policy:       OverflowDropNewest,
+		blockTimeout: defaultAsyncBlockTimeout,
+		dropLevel:    levelOrders["Warn"],
+		batchSize:    defaultAsyncBatchSize,
+		errorPrint:   rate.NewLimiter(rate.Every(osTime.Second), 1),
+	}
+	for _, op := range options {
+		op(asyncWriter)
+	}
+	asyncWriter.ch = make(chan RecyclableLog, asyncWriter.chanSize)
+	if batchWriter, ok := w.(BatchWriter); ok && asyncWriter.batchSize > 1 {
+		asyncWriter.batchWriter = batchWriter
+		asyncWriter.batch = make([]RecyclableLog, 0, asyncWriter.batchSize)
 	}
 	go asyncWriter.runWorker()
 	return asyncWriter
@@ -65,40 +144,156 @@ func (w *AsyncWriter) runWorker() {
 				// the buf channel is closed
 				return
 			}
-			err := w.LogWriter.Write(log)
-			if err != nil && w.errorPrint.Allow() {
-				_, _ = fmt.Fprintf(os.Stderr, "log async writes error: %s\n", err)
+			if w.batchWriter != nil {
+				w.writeBatch(log, w.batchWait)
+			} else {
+				w.writeLog(log)
 			}
-			w.done.Done()
 		case <-w.flush:
-			for i := 0; i < len(w.ch); i++ {
-				log := <-w.ch
-				err := w.LogWriter.Write(log)
-				if err != nil && w.errorPrint.Allow() {
-					_, _ = fmt.Fprintf(os.Stderr, "log async writes error: %s\n", err)
+			if w.batchWriter != nil {
+				for n := len(w.ch); n > 0; {
+					n -= w.writeBatch(<-w.ch, 0)
+				}
+			} else {
+				for i := 0; i < len(w.ch); i++ {
+					w.writeLog(<-w.ch)
 				}
-				w.done.Done()
 			}
 			w.flushed <- w.LogWriter.Flush()
 		}
 	}
 }
 
+func (w *AsyncWriter) writeLog(log RecyclableLog) {
+	err := w.LogWriter.Write(log)
+	if err != nil {
+		atomic.AddUint64(&w.writeErrors, 1)
+		if w.errorPrint.Allow() {
+			_, _ = fmt.Fprintf(os.Stderr, "log async writes error: %s\n", err)
+		}
+	} else {
+		atomic.AddUint64(&w.written, 1)
+	}
+	w.done.Done()
+}
+
+// writeBatch drains the logs following the first one until the batch is full,
+// it waits for the logs not arrived yet for wait at most, and returns the count of written logs.
+func (w *AsyncWriter) writeBatch(first RecyclableLog, wait osTime.Duration) int {
+	batch := append(w.batch[:0], first)
+	var timeout <-chan osTime.Time
+	if wait > 0 {
+		timer := osTime.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+collect:
+	for len(batch) < w.batchSize {
+		select {
+		case log := <-w.ch:
+			batch = append(batch, log)
+			continue
+		default:
+		}
+		if timeout == nil {
+			break collect
+		}
+		select {
+		case log := <-w.ch:
+			batch = append(batch, log)
+		case <-timeout:
+			break collect
+		}
+	}
+
+	count := len(batch)
+	err := w.batchWriter.WriteBatch(batch)
+	if err != nil {
+		atomic.AddUint64(&w.writeErrors, uint64(count))
+		if w.errorPrint.Allow() {
+			_, _ = fmt.Fprintf(os.Stderr, "log async writes error: %s\n", err)
+		}
+	} else {
+		atomic.AddUint64(&w.written, uint64(count))
+	}
+	// release the references to the recycled logs
+	for i := range batch {
+		batch[i] = nil
+	}
+	w.batch = batch[:0]
+	w.done.Add(-count)
+	return count
+}
+
 func (w *AsyncWriter) Write(log RecyclableLog) error {
 	w.done.Add(1)
-	if w.omit {
+	select {
+	case w.ch <- log:
+		atomic.AddUint64(&w.enqueued, 1)
+		return nil
+	default:
+	}
+
+	switch w.policy {
+	case OverflowBlockTimeout:
+		timer := osTime.NewTimer(w.blockTimeout)
+		defer timer.Stop()
 		select {
 		case w.ch <- log:
-		default:
-			w.done.Done()
-			log.Recycle()
+			atomic.AddUint64(&w.enqueued, 1)
+		case <-timer.C:
+			w.drop(log, &w.droppedTimeout)
 		}
-	} else {
+	case OverflowDropNewest:
+		w.drop(log, &w.droppedNewest)
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.ch <- log:
+				atomic.AddUint64(&w.enqueued, 1)
+				return nil
+			default:
+			}
+			select {
+			case oldest := <-w.ch:
+				w.drop(oldest, &w.droppedOldest)
+			default:
+			}
+		}
+	case OverflowDropBelowLevel:
+		if levelOrder(log.GetLevel()) < w.dropLevel {
+			w.drop(log, &w.droppedBelowLevel)
+			return nil
+		}
+		w.ch <- log
+		atomic.AddUint64(&w.enqueued, 1)
+	default:
 		w.ch <- log
+		atomic.AddUint64(&w.enqueued, 1)
 	}
 	return nil
 }
 
+func (w *AsyncWriter) drop(log RecyclableLog, counter *uint64) {
+	atomic.AddUint64(counter, 1)
+	log.Recycle()
+	w.done.Done()
+}
+
+// Stats returns the statistics of the writer.
+func (w *AsyncWriter) Stats() AsyncStats {
+	return AsyncStats{
+		Enqueued:          atomic.LoadUint64(&w.enqueued),
+		Written:           atomic.LoadUint64(&w.written),
+		WriteErrors:       atomic.LoadUint64(&w.writeErrors),
+		DroppedNewest:     atomic.LoadUint64(&w.droppedNewest),
+		DroppedOldest:     atomic.LoadUint64(&w.droppedOldest),
+		DroppedTimeout:    atomic.LoadUint64(&w.droppedTimeout),
+		DroppedBelowLevel: atomic.LoadUint64(&w.droppedBelowLevel),
+		QueueDepth:        len(w.ch),
+	}
+}
+
 func (w *AsyncWriter) Flush() error {
 	w.flush <- true
 	return <-w.flushed
@@ -119,3 +314,59 @@ func (w *AsyncWriter) Close() error {
 	}
 	return w.LogWriter.Close()
 }
+
+func levelOrder(level string) int {
+	order, ok := levelOrders[level]
+	if !ok {
+		return levelOrders["Info"]
+	}
+	return order
+}
+
+type AsyncOption func(*AsyncWriter)
+
+// SetBatchSize sets the max count of logs per WriteBatch call if the writer implements BatchWriter,
+// the default is 128, the batching is disabled if the size is not larger than 1.
+func SetBatchSize(size int) AsyncOption {
+	return func(writer *AsyncWriter) {
+		writer.batchSize = size
+	}
+}
+
+// SetBatchWait sets how long the worker waits for more logs to fill a batch,
+// the default is 0 which only drains the buffered logs.
+func SetBatchWait(wait osTime.Duration) AsyncOption {
+	return func(writer *AsyncWriter) {
+		writer.batchWait = wait
+	}
+}
+
+// SetAsyncChanSize sets the count of logs could be buffered, the default is 1024.
+func SetAsyncChanSize(size int) AsyncOption {
+	return func(writer *AsyncWriter) {
+		if size >= 0 {
+			writer.chanSize = size
+		}
+	}
+}
+
+// SetOverflowPolicy sets what to do if the buffer is full, the default is OverflowDropNewest.
+func SetOverflowPolicy(policy OverflowPolicy) AsyncOption {
+	return func(writer *AsyncWriter) {
+		writer.policy = policy
+	}
+}
+
+// SetBlockTimeout sets how long the user goroutine blocks in OverflowBlockTimeout, the default is 10ms.
+func SetBlockTimeout(timeout osTime.Duration) AsyncOption {
+	return func(writer *AsyncWriter) {
+		writer.blockTimeout = timeout
+	}
+}
+
+// SetDropBelowLevel sets the level name used by OverflowDropBelowLevel, e.g. "Warn" which is the default.
+func SetDropBelowLevel(level string) AsyncOption {
+	return func(writer *AsyncWriter) {
+		writer.dropLevel = levelOrder(level)
+	}
+}
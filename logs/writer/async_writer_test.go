@@ -0,0 +1,177 @@
+package writer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter blocks the writing until it is released.
+type blockingWriter struct {
+	sync.Mutex
+	release chan struct{}
+	bodies  []string
+	err     error
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(log RecyclableLog) error {
+	defer log.Recycle()
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	w.bodies = append(w.bodies, string(log.GetBody()))
+	return w.err
+}
+
+func (w *blockingWriter) Close() error { return nil }
+func (w *blockingWriter) Flush() error { return nil }
+
+// fill writes the logs until the worker is blocked and the buffer is full.
+func fillAsyncWriter(t *testing.T, w LogWriter, size int) {
+	assert.Nil(t, w.Write(newTestLog("Info", "blocked")))
+	assert.Eventually(t, func() bool { return w.(*AsyncWriter).Stats().QueueDepth == 0 }, osTime.Second, osTime.Millisecond)
+	for i := 0; i < size; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "queued")))
+	}
+}
+
+func TestAsyncWriter_DropNewest(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriterWithChanLen(bw, 2, true)
+	fillAsyncWriter(t, w, 2)
+	log := newTestLog("Error", "newest")
+	assert.Nil(t, w.Write(log))
+	assert.Equal(t, 1, log.recycled)
+
+	stats := w.(*AsyncWriter).Stats()
+	assert.Equal(t, uint64(3), stats.Enqueued)
+	assert.Equal(t, uint64(1), stats.DroppedNewest)
+	assert.Equal(t, uint64(1), stats.Dropped())
+	assert.Equal(t, 2, stats.QueueDepth)
+	close(bw.release)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []string{"blocked", "queued", "queued"}, bw.bodies)
+	assert.Equal(t, uint64(3), w.(*AsyncWriter).Stats().Written)
+}
+
+func TestAsyncWriter_DropOldest(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriterWithOptions(bw, SetAsyncChanSize(2), SetOverflowPolicy(OverflowDropOldest))
+	fillAsyncWriter(t, w, 2)
+	assert.Nil(t, w.Write(newTestLog("Info", "newest")))
+
+	stats := w.(*AsyncWriter).Stats()
+	assert.Equal(t, uint64(1), stats.DroppedOldest)
+	close(bw.release)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []string{"blocked", "queued", "newest"}, bw.bodies)
+}
+
+func TestAsyncWriter_BlockTimeout(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriterWithOptions(bw, SetAsyncChanSize(1), SetOverflowPolicy(OverflowBlockTimeout), SetBlockTimeout(10*osTime.Millisecond))
+	fillAsyncWriter(t, w, 1)
+	start := osTime.Now()
+	assert.Nil(t, w.Write(newTestLog("Info", "timeout")))
+	assert.GreaterOrEqual(t, osTime.Since(start), 10*osTime.Millisecond)
+	assert.Equal(t, uint64(1), w.(*AsyncWriter).Stats().DroppedTimeout)
+
+	// it is enqueued if the worker catches up in the timeout.
+	w.(*AsyncWriter).blockTimeout = osTime.Second
+	go func() {
+		osTime.Sleep(10 * osTime.Millisecond)
+		close(bw.release)
+	}()
+	assert.Nil(t, w.Write(newTestLog("Info", "waited")))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []string{"blocked", "queued", "waited"}, bw.bodies)
+}
+
+func TestAsyncWriter_DropBelowLevel(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriterWithOptions(bw, SetAsyncChanSize(1), SetOverflowPolicy(OverflowDropBelowLevel), SetDropBelowLevel("Warn"))
+	fillAsyncWriter(t, w, 1)
+	assert.Nil(t, w.Write(newTestLog("Notice", "dropped")))
+	assert.Equal(t, uint64(1), w.(*AsyncWriter).Stats().DroppedBelowLevel)
+
+	go func() {
+		osTime.Sleep(10 * osTime.Millisecond)
+		close(bw.release)
+	}()
+	// Warn is kept by blocking
+	assert.Nil(t, w.Write(newTestLog("Warn", "kept")))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []string{"blocked", "queued", "kept"}, bw.bodies)
+}
+
+func TestAsyncWriter_WriteErrors(t *testing.T) {
+	bw := newBlockingWriter()
+	bw.err = errors.New("write error")
+	close(bw.release)
+	w := NewAsyncWriterWithOptions(bw, SetOverflowPolicy(OverflowBlock))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "error")))
+	}
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.Close())
+	stats := w.(*AsyncWriter).Stats()
+	assert.Equal(t, uint64(3), stats.WriteErrors)
+	assert.Equal(t, uint64(0), stats.Written)
+}
+
+// batchRecorder records the size of each batch.
+type batchRecorder struct {
+	blockingWriter
+	batches []int
+}
+
+func (w *batchRecorder) WriteBatch(logs []RecyclableLog) error {
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	w.batches = append(w.batches, len(logs))
+	for _, log := range logs {
+		w.bodies = append(w.bodies, string(log.GetBody()))
+		log.Recycle()
+	}
+	return w.err
+}
+
+func TestAsyncWriter_Batch(t *testing.T) {
+	bw := &batchRecorder{blockingWriter: *newBlockingWriter()}
+	w := NewAsyncWriterWithOptions(bw, SetAsyncChanSize(100), SetOverflowPolicy(OverflowBlock), SetBatchSize(4))
+	fillAsyncWriter(t, w, 10)
+	close(bw.release)
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, []int{1, 4, 4, 2}, bw.batches)
+	assert.Equal(t, 11, len(bw.bodies))
+	assert.Equal(t, uint64(11), w.(*AsyncWriter).Stats().Written)
+
+	// the worker waits for the following logs
+	w.(*AsyncWriter).batchWait = osTime.Second
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "waited")))
+		osTime.Sleep(osTime.Millisecond)
+	}
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []int{1, 4, 4, 2, 4}, bw.batches)
+}
+
+func TestAsyncWriter_BatchDisabled(t *testing.T) {
+	bw := &batchRecorder{blockingWriter: *newBlockingWriter()}
+	close(bw.release)
+	w := NewAsyncWriterWithOptions(bw, SetBatchSize(1))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", "single")))
+	}
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 0, len(bw.batches))
+	assert.Equal(t, 3, len(bw.bodies))
+}
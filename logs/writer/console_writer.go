@@ -9,6 +9,7 @@ import (
 type ConsoleWriter struct {
 	io.WriteCloser
 	isColorful bool
+	encoder    Encoder
 }
 
 func NewConsoleWriter(options ...ConsoleOption) LogWriter {
@@ -27,6 +28,12 @@ func (w *ConsoleWriter) Write(l RecyclableLog) error {
 	defer l.Recycle()
 	var err error
 	content := l.GetContent()
+	if w.encoder != nil {
+		encoded := NewPacket(0)
+		defer PutPacket(encoded)
+		*encoded = w.encoder.Encode(*encoded, l)
+		content = *encoded
+	}
 
 	if !w.isColorful {
 		content = append(content, '\n')
@@ -69,3 +76,11 @@ func SetColorful(isColorful bool) ConsoleOption {
 		writer.isColorful = isColorful
 	}
 }
+
+// SetConsoleEncoder sets the encoder to render the logs, e.g. NewJSONEncoder() prints JSON lines.
+// The content rendered by the logger is printed if no encoder is set.
+func SetConsoleEncoder(encoder Encoder) ConsoleOption {
+	return func(writer *ConsoleWriter) {
+		writer.encoder = encoder
+	}
+}
@@ -1,5 +1,7 @@
 package writer
 
+import osTime "time"
+
 const (
 	ContextLogIDKey  = "K_LOGID"
 	ContextSpanIDKey = "K_SPANID"
@@ -8,3 +10,7 @@ const (
 const (
 	LogFileSuffixDateFormat = "2006-01-02_15"
 )
+
+const (
+	defaultCleanInterval = osTime.Minute
+)
@@ -0,0 +1,205 @@
+package writer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// LegacyContextExtractor is the name of the extractor reading the typed keys, ContextLogIDKey and ContextSpanIDKey.
+	LegacyContextExtractor = "legacy"
+	// TraceparentContextExtractor is the name of the extractor reading the W3C traceparent under ContextTraceparentKey.
+	TraceparentContextExtractor = "traceparent"
+
+	// ContextTraceparentKey is the context key of the W3C traceparent header value,
+	// e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+	ContextTraceparentKey = "traceparent"
+)
+
+// contextKey is the type of the typed context keys, which never collide with the keys of other packages.
+type contextKey int
+
+const (
+	logIDContextKey contextKey = iota
+	spanIDContextKey
+)
+
+// ContextWithLogID returns a copy of the context with the logid under a typed key,
+// which takes precedence over ContextLogIDKey.
+func ContextWithLogID(ctx context.Context, logID string) context.Context {
+	return context.WithValue(ctx, logIDContextKey, logID)
+}
+
+// ContextWithSpanID returns a copy of the context with the spanid under a typed key,
+// which takes precedence over ContextSpanIDKey.
+func ContextWithSpanID(ctx context.Context, spanID uint64) context.Context {
+	return context.WithValue(ctx, spanIDContextKey, spanID)
+}
+
+// ContextFields are the fields of a log extracted from its context.
+type ContextFields struct {
+	LogID  string
+	SpanID uint64
+	// KVs are the custom key-values appended to the log, e.g. "tenant", "t-1".
+	KVs []interface{}
+}
+
+// ContextExtractor extracts the fields from the context, the zero values mean the fields are not found.
+type ContextExtractor func(ctx context.Context) ContextFields
+
+type namedContextExtractor struct {
+	name      string
+	extractor ContextExtractor
+}
+
+var (
+	contextExtractorsLock sync.Mutex
+	contextExtractors     atomic.Value // []namedContextExtractor, copy-on-write
+)
+
+func init() {
+	contextExtractors.Store([]namedContextExtractor{
+		{name: LegacyContextExtractor, extractor: extractLegacyContext},
+		{name: TraceparentContextExtractor, extractor: extractTraceparentContext},
+	})
+}
+
+// RegisterContextExtractor registers the extractor consulted by the log prefix and the writers,
+// the extractor with the same name is replaced in place, otherwise it is appended after the registered ones.
+// The extractors are consulted in order, the first non-empty logid and spanid win, and the KVs of all extractors are appended.
+func RegisterContextExtractor(name string, extractor ContextExtractor) {
+	contextExtractorsLock.Lock()
+	defer contextExtractorsLock.Unlock()
+	old := contextExtractors.Load().([]namedContextExtractor)
+	extractors := make([]namedContextExtractor, 0, len(old)+1)
+	replaced := false
+	for _, e := range old {
+		if e.name == name {
+			e.extractor = extractor
+			replaced = true
+		}
+		extractors = append(extractors, e)
+	}
+	if !replaced {
+		extractors = append(extractors, namedContextExtractor{name: name, extractor: extractor})
+	}
+	contextExtractors.Store(extractors)
+}
+
+// UnregisterContextExtractor removes the extractor, including the built-in ones.
+func UnregisterContextExtractor(name string) {
+	contextExtractorsLock.Lock()
+	defer contextExtractorsLock.Unlock()
+	old := contextExtractors.Load().([]namedContextExtractor)
+	extractors := make([]namedContextExtractor, 0, len(old))
+	for _, e := range old {
+		if e.name != name {
+			extractors = append(extractors, e)
+		}
+	}
+	contextExtractors.Store(extractors)
+}
+
+// ExtractContext extracts the fields from the context by the registered extractors.
+func ExtractContext(ctx context.Context) ContextFields {
+	var fields ContextFields
+	if ctx == nil {
+		return fields
+	}
+	for _, e := range contextExtractors.Load().([]namedContextExtractor) {
+		f := e.extractor(ctx)
+		if fields.LogID == "" {
+			fields.LogID = f.LogID
+		}
+		if fields.SpanID == 0 {
+			fields.SpanID = f.SpanID
+		}
+		if len(f.KVs) > 0 {
+			fields.KVs = append(fields.KVs, f.KVs...)
+		}
+	}
+	return fields
+}
+
+// extractLegacyContext reads the logid and spanid under the typed keys, then ContextLogIDKey and ContextSpanIDKey,
+// the values of unexpected types under the string keys are converted if possible, otherwise ignored.
+func extractLegacyContext(ctx context.Context) ContextFields {
+	var fields ContextFields
+	if logID, ok := ctx.Value(logIDContextKey).(string); ok {
+		fields.LogID = logID
+	}
+	if spanID, ok := ctx.Value(spanIDContextKey).(uint64); ok {
+		fields.SpanID = spanID
+	}
+	if fields.LogID != "" && fields.SpanID != 0 {
+		return fields
+	}
+	var logID string
+	switch v := ctx.Value(ContextLogIDKey).(type) {
+	case nil:
+	case string:
+		logID = v
+	case []byte:
+		logID = string(v)
+	case fmt.Stringer:
+		logID = v.String()
+	}
+	var spanID uint64
+	switch v := ctx.Value(ContextSpanIDKey).(type) {
+	case nil:
+	case uint64:
+		spanID = v
+	case int64:
+		if v > 0 {
+			spanID = uint64(v)
+		}
+	case int:
+		if v > 0 {
+			spanID = uint64(v)
+		}
+	case string:
+		spanID, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if fields.LogID == "" {
+		fields.LogID = logID
+	}
+	if fields.SpanID == 0 {
+		fields.SpanID = spanID
+	}
+	return fields
+}
+
+// extractTraceparentContext reads the W3C traceparent "{version}-{trace_id}-{span_id}-{flags}",
+// the trace_id is used as the logid and the span_id is parsed as the spanid.
+func extractTraceparentContext(ctx context.Context) ContextFields {
+	var fields ContextFields
+	traceparent, ok := ctx.Value(ContextTraceparentKey).(string)
+	// 2 + 1 + 32 + 1 + 16 + 1 + 2
+	if !ok || len(traceparent) < 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return fields
+	}
+	traceID, spanID := traceparent[3:35], traceparent[36:52]
+	if !isHex(traceparent[:2]) || !isHex(traceID) || traceID == "00000000000000000000000000000000" {
+		return fields
+	}
+	id, err := strconv.ParseUint(spanID, 16, 64)
+	if err != nil || id == 0 {
+		return fields
+	}
+	fields.LogID = traceID
+	fields.SpanID = id
+	return fields
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package writer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+func TestExtractContext_Legacy(t *testing.T) {
+	assert.Equal(t, ContextFields{}, ExtractContext(nil))
+	assert.Equal(t, "-", logIDFromContext(context.Background()))
+
+	ctx := context.WithValue(context.Background(), ContextLogIDKey, "logid-1")
+	ctx = context.WithValue(ctx, ContextSpanIDKey, uint64(42))
+	assert.Equal(t, ContextFields{LogID: "logid-1", SpanID: 42}, ExtractContext(ctx))
+
+	// the values of unexpected types don't panic
+	ctx = context.WithValue(context.Background(), ContextLogIDKey, 12345)
+	ctx = context.WithValue(ctx, ContextSpanIDKey, -1)
+	assert.NotPanics(t, func() {
+		assert.Equal(t, "-", logIDFromContext(ctx))
+		assert.Equal(t, uint64(0), spanIDFromContext(ctx))
+	})
+	ctx = ContextWithSpanID(ctx, 44)
+	assert.Equal(t, ContextFields{SpanID: 44}, ExtractContext(ctx))
+	ctx = context.WithValue(context.Background(), ContextLogIDKey, stringer("logid-2"))
+	ctx = context.WithValue(ctx, ContextSpanIDKey, "43")
+	assert.Equal(t, ContextFields{LogID: "logid-2", SpanID: 43}, ExtractContext(ctx))
+}
+
+func TestExtractContext_Traceparent(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ContextTraceparentKey, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, ContextFields{LogID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: 0x00f067aa0ba902b7}, ExtractContext(ctx))
+
+	// the legacy keys take precedence
+	legacy := context.WithValue(ctx, ContextLogIDKey, "logid-1")
+	assert.Equal(t, ContextFields{LogID: "logid-1", SpanID: 0x00f067aa0ba902b7}, ExtractContext(legacy))
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		ctx := context.WithValue(context.Background(), ContextTraceparentKey, invalid)
+		assert.Equal(t, ContextFields{}, ExtractContext(ctx), invalid)
+	}
+}
+
+type tenantKey struct{}
+
+func TestRegisterContextExtractor(t *testing.T) {
+	RegisterContextExtractor("tenant", func(ctx context.Context) ContextFields {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return ContextFields{LogID: "ignored", KVs: []interface{}{"tenant", tenant}}
+		}
+		return ContextFields{}
+	})
+	defer UnregisterContextExtractor("tenant")
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "t-1")
+	ctx = context.WithValue(ctx, ContextLogIDKey, "logid-1")
+	assert.Equal(t, ContextFields{LogID: "logid-1", KVs: []interface{}{"tenant", "t-1"}}, ExtractContext(ctx))
+
+	// the extractor is replaced in place, and the built-in ones can be removed
+	RegisterContextExtractor(LegacyContextExtractor, func(ctx context.Context) ContextFields {
+		return ContextFields{LogID: "replaced"}
+	})
+	defer RegisterContextExtractor(LegacyContextExtractor, extractLegacyContext)
+	assert.Equal(t, "replaced", logIDFromContext(ctx))
+	UnregisterContextExtractor(LegacyContextExtractor)
+	assert.Equal(t, "ignored", logIDFromContext(ctx))
+}
@@ -0,0 +1,255 @@
+package writer
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Encoder renders a structured log into bytes,
+// it allows writers to output logs in another layout instead of the content rendered by the logger.
+type Encoder interface {
+	// Encode appends the encoded log to buf and returns the extended buffer,
+	// the line break is appended by writers.
+	Encode(buf []byte, log StructuredLog) []byte
+}
+
+const (
+	TimeFieldKey     = "time"
+	LevelFieldKey    = "level"
+	LocationFieldKey = "location"
+	PSMFieldKey      = "psm"
+	LogIDFieldKey    = "logid"
+	SpanIDFieldKey   = "spanid"
+	MessageFieldKey  = "msg"
+
+	// ClashingKeyPrefix is prepended to the KV keys clashing with the field keys in JSON, e.g. "fields.msg".
+	ClashingKeyPrefix = "fields."
+
+	encoderTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// JSONEncoder encodes a log to a JSON object, the kv list is flattened into the object
+// and keeps the value types, e.g. ints, floats and bools are not quoted.
+// The keys clashing with the field keys are prefixed with ClashingKeyPrefix to keep the object free of duplicate keys.
+// example:
+//
+//	{"time":"2021-07-15T15:19:14.161+08:00","level":"Info","location":"main.go:26","psm":"-","logid":"1111","spanid":0,"msg":"hello","count":100}
+type JSONEncoder struct{}
+
+// NewJSONEncoder creates a JSONEncoder.
+func NewJSONEncoder() *JSONEncoder {
+	return &JSONEncoder{}
+}
+
+func (e *JSONEncoder) Encode(buf []byte, log StructuredLog) []byte {
+	buf = append(buf, '{')
+	buf = appendJSONKey(buf, TimeFieldKey, true)
+	buf = append(buf, '"')
+	buf = log.GetTime().AppendFormat(buf, encoderTimeLayout)
+	buf = append(buf, '"')
+	buf = appendJSONKey(buf, LevelFieldKey, false)
+	buf = appendJSONString(buf, log.GetLevel())
+	buf = appendJSONKey(buf, LocationFieldKey, false)
+	buf = appendJSONString(buf, SliceByteToString(log.GetLocation()))
+	buf = appendJSONKey(buf, PSMFieldKey, false)
+	buf = appendJSONString(buf, log.GetPSM())
+	buf = appendJSONKey(buf, LogIDFieldKey, false)
+	buf = appendJSONString(buf, logIDFromContext(log.GetContext()))
+	buf = appendJSONKey(buf, SpanIDFieldKey, false)
+	buf = strconv.AppendUint(buf, spanIDFromContext(log.GetContext()), 10)
+	buf = appendJSONKey(buf, MessageFieldKey, false)
+	buf = appendJSONString(buf, SliceByteToString(log.GetBody()))
+	for _, kv := range log.GetKVList() {
+		if isFieldKey(kv.Key) {
+			buf = appendJSONKey(buf, ClashingKeyPrefix+kv.Key, false)
+		} else {
+			buf = appendJSONKey(buf, kv.Key, false)
+		}
+		buf = appendJSONValue(buf, kv)
+	}
+	return append(buf, '}')
+}
+
+func isFieldKey(key string) bool {
+	switch key {
+	case TimeFieldKey, LevelFieldKey, LocationFieldKey, PSMFieldKey, LogIDFieldKey, SpanIDFieldKey, MessageFieldKey:
+		return true
+	}
+	return false
+}
+
+func appendJSONKey(buf []byte, key string, first bool) []byte {
+	if !first {
+		buf = append(buf, ',')
+	}
+	buf = appendJSONString(buf, key)
+	return append(buf, ':')
+}
+
+// appendJSONValue appends the typed value of the kv.
+func appendJSONValue(buf []byte, kv *KeyValue) []byte {
+	switch kv.ValueType {
+	case BoolType:
+		return strconv.AppendBool(buf, len(kv.Value) > 0 && kv.Value[0] == 1)
+	case IntType:
+		valInt, _ := DecodeUint32(kv.Value)
+		return strconv.AppendInt(buf, int64(int32(valInt)), 10)
+	case LongType:
+		valLong, _ := DecodeUint64(kv.Value)
+		return strconv.AppendInt(buf, int64(valLong), 10)
+	case Uint64Type:
+		valUint64, _ := DecodeUint64(kv.Value)
+		return strconv.AppendUint(buf, valUint64, 10)
+	case DoubleType:
+		valInt64, _ := DecodeUint64(kv.Value)
+		valDouble := math.Float64frombits(valInt64)
+		if math.IsNaN(valDouble) || math.IsInf(valDouble, 0) {
+			// JSON does not support NaN and Inf
+			buf = append(buf, '"')
+			buf = strconv.AppendFloat(buf, valDouble, 'f', -1, 64)
+			return append(buf, '"')
+		}
+		return strconv.AppendFloat(buf, valDouble, 'f', -1, 64)
+	case BytesType:
+		buf = append(buf, '"')
+		start := len(buf)
+		buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(kv.Value)))...)
+		base64.StdEncoding.Encode(buf[start:], kv.Value)
+		return append(buf, '"')
+	default:
+		return appendJSONString(buf, SliceByteToString(kv.Value))
+	}
+}
+
+// appendJSONString appends a quoted JSON string, invalid UTF-8 bytes are replaced with U+FFFD.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hextable[c>>4], hextable[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
+
+// LogfmtEncoder encodes a log to a logfmt line, values are quoted only if necessary.
+// example:
+//
+//	ts=2021-07-15T15:19:14.161+08:00 level=Info loc=main.go:26 psm=- logid=1111 spanid=0 msg="hello world" count=100
+type LogfmtEncoder struct{}
+
+// NewLogfmtEncoder creates a LogfmtEncoder.
+func NewLogfmtEncoder() *LogfmtEncoder {
+	return &LogfmtEncoder{}
+}
+
+func (e *LogfmtEncoder) Encode(buf []byte, log StructuredLog) []byte {
+	buf = append(buf, "ts="...)
+	buf = log.GetTime().AppendFormat(buf, encoderTimeLayout)
+	buf = append(buf, " level="...)
+	buf = appendLogfmtValue(buf, log.GetLevel())
+	buf = append(buf, " loc="...)
+	buf = appendLogfmtValue(buf, SliceByteToString(log.GetLocation()))
+	buf = append(buf, " psm="...)
+	buf = appendLogfmtValue(buf, log.GetPSM())
+	buf = append(buf, " logid="...)
+	buf = appendLogfmtValue(buf, logIDFromContext(log.GetContext()))
+	buf = append(buf, " spanid="...)
+	buf = strconv.AppendUint(buf, spanIDFromContext(log.GetContext()), 10)
+	buf = append(buf, " msg="...)
+	buf = appendLogfmtValue(buf, SliceByteToString(log.GetBody()))
+	for _, kv := range log.GetKVList() {
+		buf = append(buf, ' ')
+		buf = appendLogfmtKey(buf, kv.Key)
+		buf = append(buf, equalByte)
+		switch kv.ValueType {
+		case StringType, TextType:
+			buf = appendLogfmtValue(buf, SliceByteToString(kv.Value))
+		case BytesType:
+			buf = appendLogfmtValue(buf, SliceByteToString(kv.AppendValueStr(nil)))
+		default:
+			// numbers and bools never need quoting
+			buf = kv.AppendValueStr(buf)
+		}
+	}
+	return buf
+}
+
+// appendLogfmtKey appends the key, the characters not allowed in a logfmt key are replaced with '_'.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			buf = append(buf, '_')
+		} else {
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return buf
+}
+
+// appendLogfmtValue appends the value, it is quoted if it is empty or contains spaces, '=', '"' or control characters.
+func appendLogfmtValue(buf []byte, s string) []byte {
+	if !logfmtNeedsQuote(s) {
+		return append(buf, s...)
+	}
+	// a JSON string is a valid quoted logfmt value
+	return appendJSONString(buf, s)
+}
+
+func logfmtNeedsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		i += size
+	}
+	return false
+}
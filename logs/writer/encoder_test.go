@@ -0,0 +1,133 @@
+package writer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONEncoder_Encode(t *testing.T) {
+	kvs := []*KeyValue{
+		NewOmniKeyValue("bool", true),
+		NewOmniKeyValue("int", int32(-12)),
+		NewOmniKeyValue("long", int64(1)<<40),
+		NewOmniKeyValue("uint64", uint64(math.MaxUint64)),
+		NewOmniKeyValue("double", 1.5),
+		NewOmniKeyValue("nan", math.NaN()),
+		NewOmniKeyValue("bytes", []byte("hi")),
+		NewOmniKeyValue("str", "a\"b\\c\n\t\x01\xff中"),
+	}
+	log := newTestLog("Info", "hello \"world\"", kvs...)
+	log.time = osTime.Date(2021, 7, 15, 15, 19, 14, 161000000, osTime.FixedZone("", 8*3600))
+	ctx := context.WithValue(context.Background(), ContextLogIDKey, "1111")
+	log.ctx = context.WithValue(ctx, ContextSpanIDKey, uint64(42))
+
+	buf := NewJSONEncoder().Encode(nil, log)
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	obj := map[string]interface{}{}
+	assert.Nil(t, dec.Decode(&obj), string(buf))
+
+	assert.Equal(t, "2021-07-15T15:19:14.161+08:00", obj[TimeFieldKey])
+	assert.Equal(t, "Info", obj[LevelFieldKey])
+	assert.Equal(t, "write_test.go:42", obj[LocationFieldKey])
+	assert.Equal(t, "test.psm", obj[PSMFieldKey])
+	assert.Equal(t, "1111", obj[LogIDFieldKey])
+	assert.Equal(t, json.Number("42"), obj[SpanIDFieldKey])
+	assert.Equal(t, "hello \"world\"", obj[MessageFieldKey])
+	assert.Equal(t, true, obj["bool"])
+	assert.Equal(t, json.Number("-12"), obj["int"])
+	assert.Equal(t, json.Number("1099511627776"), obj["long"])
+	assert.Equal(t, json.Number("18446744073709551615"), obj["uint64"])
+	assert.Equal(t, json.Number("1.5"), obj["double"])
+	assert.Equal(t, "NaN", obj["nan"])
+	assert.Equal(t, "aGk=", obj["bytes"])
+	assert.Equal(t, "a\"b\\c\n\t\x01�中", obj["str"])
+}
+
+func TestJSONEncoder_ClashingKeys(t *testing.T) {
+	log := newTestLog("Info", "hello", NewOmniKeyValue("msg", "user msg"), NewOmniKeyValue("level", 3),
+		NewOmniKeyValue("time", "now"), NewOmniKeyValue("location", "here"), NewOmniKeyValue("user", "u1"))
+	buf := NewJSONEncoder().Encode(nil, log)
+	// the standard decoder keeps the last one of the duplicate keys
+	for _, key := range []string{MessageFieldKey, LevelFieldKey, TimeFieldKey, LocationFieldKey} {
+		assert.Equal(t, 1, bytes.Count(buf, []byte(`"`+key+`":`)), string(buf))
+	}
+	obj := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf, &obj), string(buf))
+	assert.Equal(t, "hello", obj[MessageFieldKey])
+	assert.Equal(t, "Info", obj[LevelFieldKey])
+	assert.Equal(t, "write_test.go:42", obj[LocationFieldKey])
+	assert.Equal(t, "user msg", obj["fields.msg"])
+	assert.Equal(t, float64(3), obj["fields.level"])
+	assert.Equal(t, "now", obj["fields.time"])
+	assert.Equal(t, "here", obj["fields.location"])
+	assert.Equal(t, "u1", obj["user"])
+}
+
+func TestJSONEncoder_FileWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := NewFileWriter(filename, Hourly, SetFileEncoder(NewJSONEncoder()))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, w.Write(newTestLog("Warn", "line\nbreak", NewOmniKeyValue("i", i))))
+	}
+	assert.Nil(t, w.Close())
+
+	f, err := os.Open(filename)
+	assert.Nil(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lines := 0
+	for scanner.Scan() {
+		obj := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &obj))
+		assert.Equal(t, "line\nbreak", obj[MessageFieldKey])
+		assert.Equal(t, float64(lines), obj["i"])
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+}
+
+func TestLogfmtEncoder_Encode(t *testing.T) {
+	kvs := []*KeyValue{
+		NewOmniKeyValue("count", 100),
+		NewOmniKeyValue("ok", false),
+		NewOmniKeyValue("ratio", 0.25),
+		NewOmniKeyValue("bytes", []byte{1, 2}),
+		NewOmniKeyValue("empty", ""),
+		NewOmniKeyValue("plain", "abc"),
+		NewOmniKeyValue("a key=", "x=\"y\"\n"),
+	}
+	log := newTestLog("Info", "hello world", kvs...)
+	log.time = osTime.Date(2021, 7, 15, 15, 19, 14, 161000000, osTime.UTC)
+	log.ctx = context.WithValue(context.Background(), ContextLogIDKey, "1111")
+
+	buf := NewLogfmtEncoder().Encode(nil, log)
+	assert.Equal(t, `ts=2021-07-15T15:19:14.161Z level=Info loc=write_test.go:42 psm=test.psm logid=1111 spanid=0 msg="hello world"`+
+		` count=100 ok=false ratio=0.25 bytes="[1 2]" empty="" plain=abc a_key_="x=\"y\"\n"`, string(buf))
+}
+
+func TestLogfmtEncoder_ConsoleWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := NewConsoleWriter(SetColorful(false), SetConsoleEncoder(NewLogfmtEncoder()))
+	w.(*ConsoleWriter).WriteCloser = nopWriteCloser{out}
+	log := newTestLog("Warn", "done", NewOmniKeyValue("cost", 3))
+	assert.Nil(t, w.Write(log))
+	assert.Equal(t, 1, log.recycled)
+	assert.Contains(t, out.String(), " level=Warn ")
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte(" msg=done cost=3\n")), out.String())
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,175 @@
+package writer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression allows to claim how the rotated log files are compressed.
+type Compression int8
+
+const (
+	// NoCompression keeps the rotated files as they are
+	NoCompression Compression = iota
+	// Gzip compresses the rotated files to .gz files
+	Gzip
+	// Zstd compresses the rotated files to .zst files
+	Zstd
+)
+
+const (
+	gzipExt           = ".gz"
+	zstdExt           = ".zst"
+	compressTmpSuffix = ".tmp"
+)
+
+// Ext returns the file extension of the compressed files.
+func (c Compression) Ext() string {
+	switch c {
+	case Gzip:
+		return gzipExt
+	case Zstd:
+		return zstdExt
+	}
+	return ""
+}
+
+// trimCompressionExt removes the compression extension from a log file name.
+func trimCompressionExt(name string) string {
+	for _, ext := range []string{gzipExt, zstdExt} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+func (w *FileWriter) triggerCompress() {
+	if w.compressTrigger == nil {
+		return
+	}
+	select {
+	case w.compressTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func (w *FileWriter) runCompressor() {
+	defer w.background.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.compressTrigger:
+			w.compressSegments()
+		}
+	}
+}
+
+// compressSegments compresses all closed segments.
+// A segment is compressed into a temporary file which is renamed when it is complete,
+// and the original file is removed after the rename. So if the process crashes,
+// the temporary file is removed and the segment is compressed again,
+// or the original file is removed if its compressed copy has been completed.
+func (w *FileWriter) compressSegments() {
+	w.RLock()
+	active := w.currentName
+	w.RUnlock()
+
+	w.cleanLock.Lock()
+	defer w.cleanLock.Unlock()
+	for _, seg := range w.listSegments() {
+		if seg.name == active {
+			continue
+		}
+		for _, ext := range []string{gzipExt, zstdExt} {
+			_ = os.Remove(seg.name + ext + compressTmpSuffix)
+		}
+		if len(seg.files) > 1 {
+			// the compression was done but the original file was not removed.
+			_ = os.Remove(seg.name)
+			continue
+		}
+		if seg.files[0] != seg.name {
+			continue
+		}
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+		if err := compressFile(seg.name, w.compression); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "compress file %s error: %s\n", seg.name, err)
+		}
+	}
+}
+
+func compressFile(name string, c Compression) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstName := name + c.Ext()
+	tmpName := dstName + compressTmpSuffix
+	dst, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	if err = compressTo(dst, src, c); err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	// keep the modification time for the age based retention
+	_ = os.Chtimes(tmpName, info.ModTime(), info.ModTime())
+	if err = os.Rename(tmpName, dstName); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func compressTo(dst io.Writer, src io.Reader, c Compression) error {
+	var zw io.WriteCloser
+	switch c {
+	case Gzip:
+		zw = gzip.NewWriter(dst)
+	case Zstd:
+		encoder, err := zstd.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		zw = encoder
+	default:
+		return fmt.Errorf("unknown compression: %d", c)
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// SetCompression compresses the rotated log files in a background goroutine,
+// the compressed files are kept with the log files by SetKeepFiles.
+func SetCompression(c Compression) FileOption {
+	return func(writer *FileWriter) {
+		writer.compression = c
+	}
+}
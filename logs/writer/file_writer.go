@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	osTime "time"
 )
 
@@ -28,27 +30,58 @@ type FileWriter struct {
 	filename       string
 	rotationWindow RotationWindow
 	fileCountLimit int
+	fileSizeLimit  int64
+	maxAge         osTime.Duration
+	maxTotalSize   int64
+	cleanInterval  osTime.Duration
+	compression    Compression
+	encoder        Encoder
 
-	currentTimeSeg osTime.Time
+	currentTimeSeg  osTime.Time
+	currentTimeName string
+	currentName     string
+	currentSeq      int
+	currentSize     int64 // bytes written to the active segment, accessed atomically
 	sync.RWMutex
+
+	compressTrigger chan struct{}
+	done            chan struct{}
+	closeOnce       sync.Once
+	background      sync.WaitGroup
+	cleanLock       sync.Mutex
 }
 
 func NewFileWriter(filename string, window RotationWindow, options ...FileOption) LogWriter {
 	w := &FileWriter{
 		filename:       filename,
 		rotationWindow: window,
+		cleanInterval:  defaultCleanInterval,
+	}
+	for _, op := range options {
+		op(w)
 	}
 	file, err := w.loadFile()
 	if err != nil {
 		panic(err)
 	}
 	w.file = newRotatedFile(file)
-	for _, op := range options {
-		op(w)
+	w.done = make(chan struct{})
+	if w.compression != NoCompression {
+		w.compressTrigger = make(chan struct{}, 1)
+		w.background.Add(1)
+		go w.runCompressor()
+		// compress the segments left by the last run.
+		w.triggerCompress()
+	}
+	if w.needClean() && w.cleanInterval > 0 {
+		w.background.Add(1)
+		go w.runCleaner()
 	}
 	return w
 }
 
+// loadFile opens the segment of the current time window.
+// If size-based rotation is enabled, it resumes the last segment which is not full yet.
 func (w *FileWriter) loadFile() (io.WriteCloser, error) {
 	timedName, currentTimeSeg, err := timedFilename(w.filename)
 	if err != nil {
@@ -58,69 +91,190 @@ func (w *FileWriter) loadFile() (io.WriteCloser, error) {
 	if err != nil {
 		return nil, err
 	}
+	seq := 0
+	if w.fileSizeLimit > 0 {
+		seq = lastFileSeq(timedName)
+		if info, err := os.Stat(segmentFilename(timedName, seq)); err == nil && info.Size() >= w.fileSizeLimit {
+			seq++
+		}
+	}
+	file, err := w.openSegment(timedName, seq)
+	if err != nil {
+		return nil, err
+	}
+	w.currentTimeSeg = currentTimeSeg
+	return file, nil
+}
+
+// openSegment opens the file of the seq-th segment in a time window and points the symlink to it.
+func (w *FileWriter) openSegment(timedName string, seq int) (io.WriteCloser, error) {
+	var err error
 	var file *os.File
+	name := segmentFilename(timedName, seq)
 	if env := os.Getenv("IS_PROD_RUNTIME"); len(env) == 0 {
-		file, err = os.OpenFile(timedName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		file, err = os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	} else {
-		file, err = os.OpenFile(timedName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+		file, err = os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
 	}
 	if err != nil {
 		return nil, err
 	}
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
 	if _, err := os.Lstat(w.filename); err == nil {
 		_ = os.Remove(w.filename)
 	}
-	_ = os.Symlink(filepath.Base(timedName), w.filename)
-	w.currentTimeSeg = currentTimeSeg
+	_ = os.Symlink(filepath.Base(name), w.filename)
+	w.currentTimeName = timedName
+	w.currentName = name
+	w.currentSeq = seq
+	atomic.StoreInt64(&w.currentSize, size)
 	return file, nil
 }
 
 func (w *FileWriter) checkIfNeedRotate(logTime osTime.Time) error {
-	var needRotate bool
-
-	switch w.rotationWindow {
-	case Daily:
-		if w.currentTimeSeg.YearDay() != logTime.YearDay() {
-			needRotate = true
-		}
-	case Hourly:
-		if w.currentTimeSeg.Hour() != logTime.Hour() || w.currentTimeSeg.YearDay() != logTime.YearDay() {
-			needRotate = true
+	if w.needTimeRotate(logTime) {
+		defer func() {
+			w.triggerCompress()
+			go w.cleanFiles()
+		}()
+		if err := w.rotate(); err != nil {
+			return err
 		}
+		return nil
 	}
 
-	if needRotate {
+	if w.fileSizeLimit > 0 && atomic.LoadInt64(&w.currentSize) >= w.fileSizeLimit {
 		defer func() {
-			go w.cleanFiles(w.fileCountLimit)
+			w.triggerCompress()
+			go w.cleanFiles()
 		}()
-		if err := w.rotate(); err != nil {
+		if err := w.rotateBySize(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (w *FileWriter) cleanFiles(limit int) {
-	if limit <= 0 {
-		return
+func (w *FileWriter) needTimeRotate(logTime osTime.Time) bool {
+	switch w.rotationWindow {
+	case Daily:
+		return w.currentTimeSeg.YearDay() != logTime.YearDay()
+	case Hourly:
+		return w.currentTimeSeg.Hour() != logTime.Hour() || w.currentTimeSeg.YearDay() != logTime.YearDay()
 	}
-	logs := make([]string, 0)
-	_ = filepath.Walk(filepath.Dir(w.filename), func(path string, info os.FileInfo, err error) error {
-		if strings.HasPrefix(path, w.filename+".") {
-			logs = append(logs, path)
+	return false
+}
+
+func (w *FileWriter) needClean() bool {
+	return w.fileCountLimit > 0 || w.maxAge > 0 || w.maxTotalSize > 0
+}
+
+// runCleaner cleans the files periodically, so the files expire even if the writer does not rotate.
+func (w *FileWriter) runCleaner() {
+	defer w.background.Done()
+	w.cleanFiles()
+	ticker := osTime.NewTicker(w.cleanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.cleanFiles()
 		}
-		return nil
-	})
+	}
+}
 
-	if len(logs) <= limit {
+// cleanFiles removes the rotated files beyond the count limit, the max age or the max total size,
+// the oldest files are removed first and the active file is never removed.
+func (w *FileWriter) cleanFiles() {
+	if !w.needClean() {
 		return
 	}
-	sort.Slice(logs, func(i, j int) bool {
-		return getFileDate(logs[i]).After(getFileDate(logs[j]))
-	})
-	for _, f := range logs[limit:] {
-		_ = os.Remove(f)
+	w.RLock()
+	active := w.currentName
+	w.RUnlock()
+	w.cleanLock.Lock()
+	defer w.cleanLock.Unlock()
+
+	now := osTime.Now()
+	var totalSize int64
+	var exceeded bool
+	for i, seg := range w.listSegments() {
+		if seg.name == active {
+			totalSize += seg.size
+			continue
+		}
+		if w.fileCountLimit > 0 && i >= w.fileCountLimit {
+			exceeded = true
+		}
+		if w.maxTotalSize > 0 && totalSize+seg.size > w.maxTotalSize {
+			exceeded = true
+		}
+		expired := w.maxAge > 0 && now.Sub(seg.modTime) > w.maxAge
+		if !exceeded && !expired {
+			totalSize += seg.size
+			continue
+		}
+		for _, f := range seg.files {
+			_ = os.Remove(f)
+		}
+	}
+}
+
+// logSegment is a rotated log file, files contains the file and its compressed copy if there is any.
+type logSegment struct {
+	name    string
+	date    osTime.Time
+	seq     int
+	size    int64
+	modTime osTime.Time
+	files   []string
+}
+
+// listSegments lists the rotated files of the writer ordered from the newest to the oldest,
+// a segment and its compressed copy are treated as one segment.
+func (w *FileWriter) listSegments() []*logSegment {
+	absName, err := filepath.Abs(w.filename)
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Dir(absName))
+	if err != nil {
+		return nil
 	}
+	index := make(map[string]*logSegment)
+	segments := make([]*logSegment, 0, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(filepath.Dir(absName), entry.Name())
+		if entry.IsDir() || strings.HasSuffix(path, compressTmpSuffix) || !isSegmentFile(absName, path) {
+			continue
+		}
+		name := trimCompressionExt(path)
+		seg, ok := index[name]
+		if !ok {
+			seg = &logSegment{name: name, date: getFileDate(name), seq: getFileSeq(name)}
+			index[name] = seg
+			segments = append(segments, seg)
+		}
+		seg.files = append(seg.files, path)
+		if info, err := entry.Info(); err == nil {
+			seg.size += info.Size()
+			if info.ModTime().After(seg.modTime) {
+				seg.modTime = info.ModTime()
+			}
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if !segments[i].date.Equal(segments[j].date) {
+			return segments[i].date.After(segments[j].date)
+		}
+		return segments[i].seq > segments[j].seq
+	})
+	return segments
 }
 
 func (w *FileWriter) rotate() error {
@@ -132,6 +286,16 @@ func (w *FileWriter) rotate() error {
 	return nil
 }
 
+// rotateBySize moves on to the next segment of the current time window.
+func (w *FileWriter) rotateBySize() error {
+	file, err := w.openSegment(w.currentTimeName, w.currentSeq+1)
+	if err != nil {
+		return err
+	}
+	w.file.Rotate(file)
+	return nil
+}
+
 func (w *FileWriter) Write(log RecyclableLog) error {
 	defer log.Recycle()
 	w.Lock()
@@ -140,12 +304,71 @@ func (w *FileWriter) Write(log RecyclableLog) error {
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "write file %s error: %s\n", w.filename, err)
 	}
-	_, err = w.file.Write(log.GetContent())
+	content := log.GetContent()
+	if w.encoder != nil {
+		packet := NewPacket(0)
+		defer PutPacket(packet)
+		*packet = w.encoder.Encode(*packet, log)
+		content = *packet
+	}
+	n, err := w.file.Write(content)
+	atomic.AddInt64(&w.currentSize, int64(n))
 	return err
 }
 
+// WriteBatch writes the logs with one lock acquisition and one buffered write,
+// the logs before a rotation in the middle of the batch are written to the previous file.
+func (w *FileWriter) WriteBatch(logs []RecyclableLog) error {
+	packet := NewPacket(0)
+	defer PutPacket(packet)
+	var firstErr error
+	writePending := func() {
+		if len(*packet) == 0 {
+			return
+		}
+		n, err := w.file.Write(*packet)
+		atomic.AddInt64(&w.currentSize, int64(n))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		*packet = (*packet)[:0]
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	for _, log := range logs {
+		logTime := log.GetTime()
+		if w.needTimeRotate(logTime) ||
+			w.fileSizeLimit > 0 && atomic.LoadInt64(&w.currentSize)+int64(len(*packet)) >= w.fileSizeLimit {
+			writePending()
+			if err := w.checkIfNeedRotate(logTime); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "write file %s error: %s\n", w.filename, err)
+			}
+		}
+		start := len(*packet)
+		if w.encoder != nil {
+			*packet = w.encoder.Encode(*packet, log)
+		} else {
+			*packet = append(*packet, log.GetContent()...)
+		}
+		if len(*packet) == start || (*packet)[len(*packet)-1] != '\n' {
+			*packet = append(*packet, '\n')
+		}
+		log.Recycle()
+	}
+	writePending()
+	return firstErr
+}
+
+// Close closes the file and stops the background goroutines, the later calls do nothing and return nil.
 func (w *FileWriter) Close() error {
-	return w.file.Close()
+	var err error
+	w.closeOnce.Do(func() {
+		err = w.file.Close()
+		close(w.done)
+		w.background.Wait()
+	})
+	return err
 }
 
 func (w *FileWriter) Flush() error {
@@ -162,10 +385,69 @@ func timedFilename(filename string) (string, osTime.Time, error) {
 	return absPath + "." + now.Format(LogFileSuffixDateFormat), now, nil
 }
 
+// segmentFilename appends the sequence suffix to a timed filename, the first segment has no suffix.
+// e.g. app.log.2023-08-23_07, app.log.2023-08-23_07.1, app.log.2023-08-23_07.2
+func segmentFilename(timedName string, seq int) string {
+	if seq <= 0 {
+		return timedName
+	}
+	return timedName + "." + strconv.Itoa(seq)
+}
+
+// lastFileSeq returns the largest sequence of the existing segments of a timed filename.
+func lastFileSeq(timedName string) int {
+	matches, _ := filepath.Glob(timedName + ".*")
+	last := 0
+	for _, m := range matches {
+		if seq := getFileSeq(m); seq > last {
+			last = seq
+		}
+	}
+	return last
+}
+
 type FileOption func(writer *FileWriter)
 
+// SetKeepFiles keeps the newest n rotated files and removes the older ones.
 func SetKeepFiles(n int) FileOption {
 	return func(writer *FileWriter) {
 		writer.fileCountLimit = n
 	}
 }
+
+// SetMaxAge removes the rotated files which are not modified in the last d.
+func SetMaxAge(d osTime.Duration) FileOption {
+	return func(writer *FileWriter) {
+		writer.maxAge = d
+	}
+}
+
+// SetMaxTotalSize removes the oldest rotated files once the total size of the log files passes n bytes.
+func SetMaxTotalSize(n int64) FileOption {
+	return func(writer *FileWriter) {
+		writer.maxTotalSize = n
+	}
+}
+
+// SetCleanInterval sets how often the writer checks the retention of the files, it is 1 minute by default.
+func SetCleanInterval(d osTime.Duration) FileOption {
+	return func(writer *FileWriter) {
+		writer.cleanInterval = d
+	}
+}
+
+// SetFileEncoder sets the encoder to render the logs, e.g. NewJSONEncoder() writes JSON lines.
+// The content rendered by the logger is written if no encoder is set.
+func SetFileEncoder(encoder Encoder) FileOption {
+	return func(writer *FileWriter) {
+		writer.encoder = encoder
+	}
+}
+
+// SetMaxFileSize rolls the log file once it passes n bytes,
+// the segments of the same time window are suffixed with a sequence, e.g. app.log.2023-08-23_07.1.
+func SetMaxFileSize(n int64) FileOption {
+	return func(writer *FileWriter) {
+		writer.fileSizeLimit = n
+	}
+}
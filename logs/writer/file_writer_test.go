@@ -0,0 +1,264 @@
+package writer
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	osTime "time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWriter_MaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w := NewFileWriter(filename, Hourly, SetMaxFileSize(64))
+	// each log takes 36 bytes with the line break, so every segment holds two logs.
+	for i := 0; i < 9; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", strings.Repeat("x", 30))))
+	}
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.Close())
+	// closing again does nothing
+	assert.Nil(t, w.Close())
+
+	segments, err := filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(segments))
+
+	fw := w.(*FileWriter)
+	link, err := os.Readlink(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Base(segmentFilename(fw.currentTimeName, 4)), link)
+	for _, s := range segments {
+		info, err := os.Stat(s)
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(2*36))
+	}
+
+	// a new writer resumes the last segment which is not full.
+	w = NewFileWriter(filename, Hourly, SetMaxFileSize(64))
+	assert.Equal(t, 4, w.(*FileWriter).currentSeq)
+	assert.Nil(t, w.Close())
+}
+
+func TestFileWriter_CleanSegments(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	base := osTime.Date(2023, 8, 23, 7, 0, 0, 0, osTime.UTC)
+	names := []string{
+		filename + "." + base.Format(LogFileSuffixDateFormat),
+		filename + "." + base.Format(LogFileSuffixDateFormat) + ".1",
+		filename + "." + base.Format(LogFileSuffixDateFormat) + ".2",
+		filename + "." + base.Add(osTime.Hour).Format(LogFileSuffixDateFormat),
+		filename + "." + base.Add(osTime.Hour).Format(LogFileSuffixDateFormat) + ".1",
+	}
+	for _, name := range names {
+		assert.Nil(t, os.WriteFile(name, []byte("log"), 0644))
+	}
+	assert.Equal(t, 2, getFileSeq(names[2]))
+	assert.Equal(t, 0, getFileSeq(names[3]))
+	assert.True(t, getFileDate(names[2]).Equal(base))
+
+	w := &FileWriter{filename: filename, fileCountLimit: 3}
+	w.cleanFiles()
+	left, err := filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{names[2], names[3], names[4]}, left)
+}
+
+func TestFileWriter_NeighbourFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	date := osTime.Now().Add(-10 * osTime.Hour).Format(LogFileSuffixDateFormat)
+	segment := filename + "." + date + ".1"
+	// the files of another writer sharing the base name, and a backup
+	neighbours := []string{filename + ".wf", filename + ".wf." + date, filename + ".bak", filename + "." + date + ".bak"}
+	for _, name := range append([]string{segment}, neighbours...) {
+		assert.Nil(t, os.WriteFile(name, []byte(name+"\n"), 0644))
+		assert.Nil(t, os.Chtimes(name, osTime.Now().Add(-10*osTime.Hour), osTime.Now().Add(-10*osTime.Hour)))
+	}
+	assert.True(t, isSegmentFile(filename, segment+gzipExt))
+	assert.False(t, isSegmentFile(filename, filename+"."+date+".x1"))
+
+	w := NewFileWriter(filename, Hourly, SetCompression(Gzip), SetMaxAge(osTime.Hour)).(*FileWriter)
+	osTime.Sleep(200 * osTime.Millisecond)
+	w.cleanFiles()
+	assert.Nil(t, w.Close())
+
+	// the expired segment is compressed and removed, and the neighbours survive
+	left, err := filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, append([]string{w.currentName}, neighbours...), left)
+	for _, name := range neighbours {
+		data, err := os.ReadFile(name)
+		assert.Nil(t, err)
+		assert.Equal(t, name+"\n", string(data))
+	}
+}
+
+func readCompressed(t *testing.T, name string, c Compression) string {
+	file, err := os.Open(name)
+	assert.Nil(t, err)
+	defer file.Close()
+	var r io.Reader
+	switch c {
+	case Gzip:
+		r, err = gzip.NewReader(file)
+	case Zstd:
+		r, err = zstd.NewReader(file)
+	}
+	assert.Nil(t, err)
+	data, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestFileWriter_Compression(t *testing.T) {
+	for _, c := range []Compression{Gzip, Zstd} {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		w := NewFileWriter(filename, Hourly, SetMaxFileSize(64), SetCompression(c))
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, w.Write(newTestLog("Info", strings.Repeat("x", 30))))
+		}
+		// wait for the background compression
+		osTime.Sleep(200 * osTime.Millisecond)
+		assert.Nil(t, w.Close())
+
+		compressed, err := filepath.Glob(filename + ".*" + c.Ext())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(compressed))
+		for _, name := range compressed {
+			assert.Equal(t, strings.Repeat("Info "+strings.Repeat("x", 30)+"\n", 2), readCompressed(t, name, c))
+			_, err := os.Stat(trimCompressionExt(name))
+			assert.True(t, os.IsNotExist(err))
+		}
+		active := w.(*FileWriter).currentName
+		_, err = os.Stat(active)
+		assert.Nil(t, err)
+	}
+}
+
+func TestFileWriter_CompressionRecovery(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	date := osTime.Date(2023, 8, 23, 7, 0, 0, 0, osTime.UTC).Format(LogFileSuffixDateFormat)
+	done := filename + "." + date
+	interrupted := filename + "." + date + ".1"
+	untouched := filename + "." + date + ".2"
+	for _, name := range []string{done, interrupted, untouched} {
+		assert.Nil(t, os.WriteFile(name, []byte(name+"\n"), 0644))
+	}
+	// the process crashed after renaming the compressed file
+	assert.Nil(t, compressFile(done, Gzip))
+	assert.Nil(t, os.WriteFile(done, []byte(done+"\n"), 0644))
+	// the process crashed while compressing
+	assert.Nil(t, os.WriteFile(interrupted+gzipExt+compressTmpSuffix, []byte("broken"), 0644))
+
+	w := NewFileWriter(filename, Hourly, SetCompression(Gzip))
+	osTime.Sleep(200 * osTime.Millisecond)
+	assert.Nil(t, w.Close())
+
+	for _, name := range []string{done, interrupted, untouched} {
+		_, err := os.Stat(name)
+		assert.True(t, os.IsNotExist(err))
+		assert.Equal(t, name+"\n", readCompressed(t, name+gzipExt, Gzip))
+	}
+	tmp, err := filepath.Glob(filename + ".*" + compressTmpSuffix)
+	assert.Nil(t, err)
+	assert.Empty(t, tmp)
+
+	// compressed files are in the same retention set
+	w.(*FileWriter).fileCountLimit = 2
+	w.(*FileWriter).cleanFiles()
+	left, err := filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{w.(*FileWriter).currentName, untouched + gzipExt}, left)
+}
+
+func TestFileWriter_Retention(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	base := osTime.Now().Add(-10 * osTime.Hour)
+	names := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		date := base.Add(osTime.Duration(i) * osTime.Hour)
+		name := filename + "." + date.Format(LogFileSuffixDateFormat)
+		assert.Nil(t, os.WriteFile(name, []byte(strings.Repeat("x", 100)), 0644))
+		assert.Nil(t, os.Chtimes(name, date, date))
+		names = append(names, name)
+	}
+
+	// the files modified more than 7.5 hours ago expire
+	w := &FileWriter{filename: filename, maxAge: 7*osTime.Hour + 30*osTime.Minute}
+	w.cleanFiles()
+	left, err := filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, names[3:], left)
+
+	// the oldest files are removed until the total size fits
+	w = &FileWriter{filename: filename, maxTotalSize: 250}
+	w.cleanFiles()
+	left, err = filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, names[4:], left)
+
+	// a quiet writer cleans the files periodically
+	w = NewFileWriter(filename, Hourly, SetMaxAge(7*osTime.Hour), SetCleanInterval(50*osTime.Millisecond)).(*FileWriter)
+	assert.Nil(t, os.Chtimes(names[5], base, base))
+	osTime.Sleep(200 * osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	left, err = filepath.Glob(filename + ".*")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{names[4], w.currentName}, left)
+}
+
+func TestFileWriter_CloseTwice(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w := NewFileWriter(filename, Hourly, SetMaxAge(osTime.Hour), SetCleanInterval(10*osTime.Millisecond))
+	assert.Nil(t, w.Write(newTestLog("Info", "hello")))
+	assert.Nil(t, w.Close())
+	// the cleaner is stopped once and the later calls do nothing
+	assert.NotPanics(t, func() {
+		assert.Nil(t, w.Close())
+	})
+}
+
+func TestFileWriter_WriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	batchName := filepath.Join(dir, "batch.log")
+	singleName := filepath.Join(dir, "single.log")
+	batchWriter := NewFileWriter(batchName, Hourly, SetMaxFileSize(64))
+	singleWriter := NewFileWriter(singleName, Hourly, SetMaxFileSize(64))
+	logs := make([]RecyclableLog, 0, 9)
+	for i := 0; i < 9; i++ {
+		logs = append(logs, newTestLog("Info", strings.Repeat(strconv.Itoa(i), 30)))
+		assert.Nil(t, singleWriter.Write(newTestLog("Info", strings.Repeat(strconv.Itoa(i), 30))))
+	}
+	assert.Nil(t, batchWriter.(BatchWriter).WriteBatch(logs))
+	for _, log := range logs {
+		assert.Equal(t, 1, log.(*testLog).recycled)
+	}
+	assert.Nil(t, batchWriter.Close())
+	assert.Nil(t, singleWriter.Close())
+
+	// the batch rotates in the middle like writing one by one.
+	batchSegments, _ := filepath.Glob(batchName + ".*")
+	singleSegments, _ := filepath.Glob(singleName + ".*")
+	assert.Equal(t, 5, len(batchSegments))
+	assert.Equal(t, len(singleSegments), len(batchSegments))
+	for i := range batchSegments {
+		batchContent, err := os.ReadFile(batchSegments[i])
+		assert.Nil(t, err)
+		singleContent, err := os.ReadFile(singleSegments[i])
+		assert.Nil(t, err)
+		assert.Equal(t, string(singleContent), string(batchContent))
+	}
+}
@@ -0,0 +1,355 @@
+package writer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Predicate reports whether a log should be handled by a writer.
+type Predicate func(log StructuredLog) bool
+
+// LevelAtLeast matches the logs whose level is not lower than level, e.g. LevelAtLeast("Warn").
+// The level name is case-insensitive.
+func LevelAtLeast(level string) Predicate {
+	if name, ok := parseLevelName(level); ok {
+		level = name
+	}
+	order := levelOrder(level)
+	return func(log StructuredLog) bool {
+		return levelOrder(log.GetLevel()) >= order
+	}
+}
+
+// LevelIn matches the logs of the levels, the level names are case-insensitive.
+func LevelIn(levels ...string) Predicate {
+	names := make([]string, 0, len(levels))
+	for _, l := range levels {
+		if name, ok := parseLevelName(l); ok {
+			l = name
+		}
+		names = append(names, l)
+	}
+	return func(log StructuredLog) bool {
+		level := log.GetLevel()
+		for _, l := range names {
+			if l == level {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseLevelName returns the canonical name of the level case-insensitively like logs.ParseLevel, e.g. "Warn" of "warn".
+func parseLevelName(level string) (string, bool) {
+	for name := range levelOrders {
+		if strings.EqualFold(name, level) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// LocationGlob matches the file of the log location, the line number is ignored.
+// The pattern is matched with the trailing elements of the path by path.Match like the vmodule of the logger,
+// e.g. "pkg/payment/*" matches "/src/app/pkg/payment/pay.go" and "pay.go" matches the file in any directory.
+// Please note that the logger only records the file name without SetFullPath,
+// so the patterns with a '/' never match such locations and a warning is printed once.
+func LocationGlob(pattern string) Predicate {
+	hasDir := strings.Contains(pattern, "/")
+	var warnOnce sync.Once
+	return func(log StructuredLog) bool {
+		location := SliceByteToString(log.GetLocation())
+		if i := strings.LastIndexByte(location, ':'); i >= 0 {
+			location = location[:i]
+		}
+		if hasDir && !strings.Contains(location, "/") {
+			warnOnce.Do(func() {
+				_, _ = fmt.Fprintf(os.Stderr, "location glob %q never matches the location %q without directory, "+
+					"please enable SetFullPath of the logger\n", pattern, location)
+			})
+			return false
+		}
+		return matchPathSuffix(pattern, location)
+	}
+}
+
+// matchPathSuffix matches the pattern with the trailing elements of the path,
+// e.g. "storage/*.go" matches "/home/foo/project/storage/db.go".
+func matchPathSuffix(pattern, name string) bool {
+	n := strings.Count(pattern, "/") + 1
+	i := len(name)
+	for ; n > 0 && i >= 0; n-- {
+		i = strings.LastIndexByte(name[:i], '/')
+	}
+	if n > 0 {
+		// the path has less elements than the pattern
+		return false
+	}
+	matched, _ := path.Match(pattern, name[i+1:])
+	return matched
+}
+
+// PSMIn matches the logs of the PSMs.
+func PSMIn(psms ...string) Predicate {
+	return func(log StructuredLog) bool {
+		psm := log.GetPSM()
+		for _, p := range psms {
+			if p == psm {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HasKV matches the logs containing the key in the KV list.
+func HasKV(key string) Predicate {
+	return func(log StructuredLog) bool {
+		for _, kv := range log.GetKVList() {
+			if kv.Key == key {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// KVEquals matches the logs containing the key-value in the KV list,
+// typed values are compared in string format, e.g. KVEquals("audit", "true").
+func KVEquals(key, value string) Predicate {
+	return func(log StructuredLog) bool {
+		for _, kv := range log.GetKVList() {
+			if kv.Key != key {
+				continue
+			}
+			switch kv.ValueType {
+			case StringType, TextType:
+				if SliceByteToString(kv.Value) == value {
+					return true
+				}
+			default:
+				packet := NewPacket(0)
+				*packet = kv.AppendValueStr(*packet)
+				equal := SliceByteToString(*packet) == value
+				PutPacket(packet)
+				if equal {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// BodyMatches matches the logs whose body matches the regular expression.
+func BodyMatches(re *regexp.Regexp) Predicate {
+	return func(log StructuredLog) bool {
+		return re.Match(log.GetBody())
+	}
+}
+
+// And matches the logs matched by all the predicates.
+func And(predicates ...Predicate) Predicate {
+	return func(log StructuredLog) bool {
+		for _, p := range predicates {
+			if !p(log) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches the logs matched by any of the predicates.
+func Or(predicates ...Predicate) Predicate {
+	return func(log StructuredLog) bool {
+		for _, p := range predicates {
+			if p(log) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches the logs not matched by the predicate.
+func Not(predicate Predicate) Predicate {
+	return func(log StructuredLog) bool {
+		return !predicate(log)
+	}
+}
+
+// FilterWriter only writes the logs matched by the predicate, other logs are recycled.
+type FilterWriter struct {
+	LogWriter
+	predicate Predicate
+}
+
+// NewFilterWriter creates a FilterWriter.
+func NewFilterWriter(w LogWriter, predicate Predicate) LogWriter {
+	return &FilterWriter{
+		LogWriter: w,
+		predicate: predicate,
+	}
+}
+
+func (w *FilterWriter) Write(log RecyclableLog) error {
+	if !w.predicate(log) {
+		log.Recycle()
+		return nil
+	}
+	return w.LogWriter.Write(log)
+}
+
+// Route sends the logs matched by the predicate to the writer.
+type Route struct {
+	Predicate Predicate
+	Writer    LogWriter
+}
+
+// RouterWriter sends each log to the writer of the first matched route,
+// the logs matching no route are written to the default writer, or recycled if it is nil.
+type RouterWriter struct {
+	routes        []Route
+	defaultWriter LogWriter
+}
+
+// NewRouterWriter creates a RouterWriter, defaultWriter could be nil to discard unmatched logs.
+func NewRouterWriter(defaultWriter LogWriter, routes ...Route) LogWriter {
+	return &RouterWriter{
+		routes:        routes,
+		defaultWriter: defaultWriter,
+	}
+}
+
+func (w *RouterWriter) Write(log RecyclableLog) error {
+	for _, route := range w.routes {
+		if route.Predicate(log) {
+			return route.Writer.Write(log)
+		}
+	}
+	if w.defaultWriter == nil {
+		log.Recycle()
+		return nil
+	}
+	return w.defaultWriter.Write(log)
+}
+
+func (w *RouterWriter) Flush() error {
+	var err error
+	w.forEachWriter(func(writer LogWriter) {
+		if e := writer.Flush(); e != nil && err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+func (w *RouterWriter) Close() error {
+	var err error
+	w.forEachWriter(func(writer LogWriter) {
+		if e := writer.Close(); e != nil && err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+// forEachWriter calls f once for each writer, a writer used by several routes is only called once.
+func (w *RouterWriter) forEachWriter(f func(writer LogWriter)) {
+	visited := make(map[LogWriter]bool, len(w.routes)+1)
+	for _, route := range w.routes {
+		if !visited[route.Writer] {
+			visited[route.Writer] = true
+			f(route.Writer)
+		}
+	}
+	if w.defaultWriter != nil && !visited[w.defaultWriter] {
+		f(w.defaultWriter)
+	}
+}
+
+// RouteRule is a route declared in config, the log must match all the set conditions.
+type RouteRule struct {
+	// Writer is the name of the writer to send the matched logs.
+	Writer string `json:"writer" yaml:"writer"`
+	// Level matches the logs not lower than it case-insensitively, e.g. "Warn" or "warn".
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Location is a glob of the file location, see LocationGlob.
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+	PSM      string `json:"psm,omitempty" yaml:"psm,omitempty"`
+	// KVKey matches the logs containing the key, and the value must be KVValue if it is set.
+	KVKey   string `json:"kv_key,omitempty" yaml:"kv_key,omitempty"`
+	KVValue string `json:"kv_value,omitempty" yaml:"kv_value,omitempty"`
+	// Body is a regular expression of the log body.
+	Body string `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Predicate builds the predicate of the rule, a rule without conditions matches all logs.
+func (r *RouteRule) Predicate() (Predicate, error) {
+	predicates := make([]Predicate, 0, 5)
+	if r.Level != "" {
+		level, ok := parseLevelName(r.Level)
+		if !ok {
+			return nil, fmt.Errorf("invalid level %q", r.Level)
+		}
+		predicates = append(predicates, LevelAtLeast(level))
+	}
+	if r.Location != "" {
+		if _, err := path.Match(r.Location, ""); err != nil {
+			return nil, fmt.Errorf("invalid location %q: %w", r.Location, err)
+		}
+		predicates = append(predicates, LocationGlob(r.Location))
+	}
+	if r.PSM != "" {
+		predicates = append(predicates, PSMIn(r.PSM))
+	}
+	if r.KVKey != "" {
+		if r.KVValue != "" {
+			predicates = append(predicates, KVEquals(r.KVKey, r.KVValue))
+		} else {
+			predicates = append(predicates, HasKV(r.KVKey))
+		}
+	} else if r.KVValue != "" {
+		return nil, fmt.Errorf("kv_value %q is set without kv_key", r.KVValue)
+	}
+	if r.Body != "" {
+		re, err := regexp.Compile(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, BodyMatches(re))
+	}
+	return And(predicates...), nil
+}
+
+// NewRouterWriterFromRules creates a RouterWriter from the rules in config,
+// the writers of rules and the default writer are looked up by name in writers,
+// defaultName could be empty to discard unmatched logs.
+func NewRouterWriterFromRules(rules []RouteRule, writers map[string]LogWriter, defaultName string) (LogWriter, error) {
+	routes := make([]Route, 0, len(rules))
+	for i := range rules {
+		writer, ok := writers[rules[i].Writer]
+		if !ok {
+			return nil, fmt.Errorf("route %d: unknown writer %q", i, rules[i].Writer)
+		}
+		predicate, err := rules[i].Predicate()
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		routes = append(routes, Route{Predicate: predicate, Writer: writer})
+	}
+	var defaultWriter LogWriter
+	if defaultName != "" {
+		var ok bool
+		if defaultWriter, ok = writers[defaultName]; !ok {
+			return nil, fmt.Errorf("unknown default writer %q", defaultName)
+		}
+	}
+	return NewRouterWriter(defaultWriter, routes...), nil
+}
@@ -0,0 +1,107 @@
+package writer
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredicates(t *testing.T) {
+	log := newTestLog("Warn", "pay order 123", NewOmniKeyValue("audit", true), NewOmniKeyValue("user", "u1"))
+	log.location = []byte("/src/app/pkg/payment/pay.go:26")
+
+	assert.True(t, LevelAtLeast("Warn")(log))
+	assert.False(t, LevelAtLeast("Error")(log))
+	assert.True(t, LevelAtLeast("warn")(log))
+	assert.False(t, LevelAtLeast("ERROR")(log))
+	assert.True(t, LevelIn("Info", "Warn")(log))
+	assert.True(t, LevelIn("warn")(log))
+	assert.True(t, LocationGlob("pkg/payment/*")(log))
+	assert.True(t, LocationGlob("pay.go")(log))
+	assert.True(t, LocationGlob("*/payment/p?y.go")(log))
+	assert.False(t, LocationGlob("payment")(log))
+	assert.False(t, LocationGlob("ay.go")(log))
+	// '*' does not match '/'
+	assert.False(t, LocationGlob("app/*")(log))
+	assert.True(t, LocationGlob("app/*/*/*.go")(log))
+
+	// the location of the file name only
+	log.location = []byte("pay.go:26")
+	assert.True(t, LocationGlob("p*.go")(log))
+	assert.False(t, LocationGlob("pkg/payment/*")(log))
+	assert.True(t, PSMIn("test.psm")(log))
+	assert.True(t, HasKV("audit")(log))
+	assert.False(t, HasKV("missing")(log))
+	assert.True(t, KVEquals("audit", "true")(log))
+	assert.True(t, KVEquals("user", "u1")(log))
+	assert.False(t, KVEquals("user", "u2")(log))
+	assert.True(t, BodyMatches(regexp.MustCompile(`order \d+`))(log))
+	assert.True(t, And(HasKV("audit"), Not(HasKV("missing")))(log))
+	assert.True(t, Or(HasKV("missing"), LevelIn("Warn"))(log))
+	assert.True(t, And()(log))
+}
+
+func TestFilterWriter(t *testing.T) {
+	fw := &flakyWriter{}
+	w := NewFilterWriter(fw, LevelAtLeast("Warn"))
+	info := newTestLog("Info", "info")
+	assert.Nil(t, w.Write(info))
+	assert.Nil(t, w.Write(newTestLog("Error", "error")))
+	assert.Equal(t, 1, info.recycled)
+	assert.Equal(t, []string{"error"}, fw.logs)
+	assert.Nil(t, w.Close())
+}
+
+func TestRouterWriter(t *testing.T) {
+	config := `[
+		{"writer": "audit", "kv_key": "audit", "kv_value": "true"},
+		{"writer": "payment", "location": "pkg/payment/*"},
+		{"writer": "errors", "level": "error", "body": "^fail"}
+	]`
+	var rules []RouteRule
+	assert.Nil(t, json.Unmarshal([]byte(config), &rules))
+	audit, payment, errs, def := &flakyWriter{}, &flakyWriter{}, &flakyWriter{}, &flakyWriter{}
+	writers := map[string]LogWriter{"audit": audit, "payment": payment, "errors": errs, "default": def}
+	w, err := NewRouterWriterFromRules(rules, writers, "default")
+	assert.Nil(t, err)
+
+	paymentLog := newTestLog("Info", "payment", NewOmniKeyValue("audit", false))
+	paymentLog.location = []byte("/src/pkg/payment/pay.go:10")
+	// the first matched route wins
+	auditLog := newTestLog("Info", "audit", NewOmniKeyValue("audit", true))
+	auditLog.location = paymentLog.location
+	for _, log := range []*testLog{
+		paymentLog,
+		auditLog,
+		newTestLog("Error", "failed"),
+		newTestLog("Error", "other error"),
+		newTestLog("Info", "other"),
+	} {
+		assert.Nil(t, w.Write(log))
+		assert.Equal(t, 1, log.recycled)
+	}
+	assert.Equal(t, []string{"audit"}, audit.logs)
+	assert.Equal(t, []string{"payment"}, payment.logs)
+	assert.Equal(t, []string{"failed"}, errs.logs)
+	assert.Equal(t, []string{"other error", "other"}, def.logs)
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.Close())
+
+	// unmatched logs are recycled without the default writer
+	w, err = NewRouterWriterFromRules(rules[:1], writers, "")
+	assert.Nil(t, err)
+	log := newTestLog("Info", "dropped")
+	assert.Nil(t, w.Write(log))
+	assert.Equal(t, 1, log.recycled)
+
+	_, err = NewRouterWriterFromRules([]RouteRule{{Writer: "unknown"}}, writers, "")
+	assert.NotNil(t, err)
+	_, err = NewRouterWriterFromRules([]RouteRule{{Writer: "audit", Body: "("}}, writers, "")
+	assert.NotNil(t, err)
+	_, err = NewRouterWriterFromRules([]RouteRule{{Writer: "audit", Level: "Verbose"}}, writers, "")
+	assert.NotNil(t, err)
+	_, err = NewRouterWriterFromRules([]RouteRule{{Writer: "audit", Location: "pkg/[payment"}}, writers, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,359 @@
+package writer
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	osTime "time"
+)
+
+const (
+	// FlightReplayKey is the key marking the logs replayed by FlightRecorder.
+	FlightReplayKey = "_replay"
+
+	defaultFlightCapacity = 128
+	defaultFlightMaxRings = 1024
+	defaultFlightMaxBytes = 16 * 1024 * 1024
+
+	// flightLogOverhead is the estimated memory of a recordedLog besides its data.
+	flightLogOverhead = 160
+	flightGlobalKey   = "-"
+)
+
+var flightReplayMark = []byte(" " + FlightReplayKey + "=true")
+
+// FlightRecorder keeps the recent logs below the level in memory per logid,
+// and replays them to the writer when an error log of the same logid is written,
+// so that the context of the error is kept without writing the verbose logs all the time.
+// The recorded logs are copied as they are, there is no encoding cost unless they are replayed.
+// Set the recorder's level in the logger lower than the recorded logs, e.g.
+//
+//	logs.SetWriter(logs.DebugLevel, writer.NewFlightRecorder(fileWriter))
+//
+// The memory is bounded by the capacity of each logid, the max number of logids and the max bytes in total,
+// the least recently used logids are evicted first.
+type FlightRecorder struct {
+	w            LogWriter
+	level        int
+	triggerLevel int
+	perLogID     bool
+	capacity     int
+	maxRings     int
+	maxBytes     int
+
+	lock  sync.Mutex
+	rings map[string]*list.Element // the values are *flightRing
+	lru   *list.List               // the front is the most recently used
+	bytes int
+}
+
+// NewFlightRecorder creates a FlightRecorder writing the logs to w.
+// By default, the logs below Info are recorded and the Error and Fatal logs trigger the replay.
+func NewFlightRecorder(w LogWriter, options ...FlightRecorderOption) *FlightRecorder {
+	r := &FlightRecorder{
+		w:            w,
+		level:        levelOrder("Info"),
+		triggerLevel: levelOrder("Error"),
+		perLogID:     true,
+		capacity:     defaultFlightCapacity,
+		maxRings:     defaultFlightMaxRings,
+		maxBytes:     defaultFlightMaxBytes,
+		rings:        make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+func (r *FlightRecorder) Write(log RecyclableLog) error {
+	level := levelOrder(log.GetLevel())
+	if level < r.level {
+		r.record(log)
+		log.Recycle()
+		return nil
+	}
+	if level < r.triggerLevel {
+		return r.w.Write(log)
+	}
+
+	var firstErr error
+	for _, recorded := range r.take(r.key(log.GetContext())) {
+		if err := r.w.Write(recorded); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := r.w.Write(log); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func (r *FlightRecorder) Flush() error {
+	return r.w.Flush()
+}
+
+// Close discards the recorded logs and closes the writer.
+func (r *FlightRecorder) Close() error {
+	r.lock.Lock()
+	for e := r.lru.Front(); e != nil; e = e.Next() {
+		for _, recorded := range e.Value.(*flightRing).drain() {
+			recorded.Recycle()
+		}
+	}
+	r.rings = make(map[string]*list.Element)
+	r.lru.Init()
+	r.bytes = 0
+	r.lock.Unlock()
+	return r.w.Close()
+}
+
+func (r *FlightRecorder) key(ctx context.Context) string {
+	if !r.perLogID {
+		return flightGlobalKey
+	}
+	return logIDFromContext(ctx)
+}
+
+func (r *FlightRecorder) record(log RecyclableLog) {
+	recorded := newRecordedLog(log)
+	if recorded.size > r.maxBytes {
+		recorded.Recycle()
+		return
+	}
+	key := r.key(log.GetContext())
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.rings[key]
+	if ok {
+		r.lru.MoveToFront(e)
+	} else {
+		if r.lru.Len() >= r.maxRings {
+			r.removeRing(r.lru.Back())
+		}
+		e = r.lru.PushFront(newFlightRing(key, r.capacity))
+		r.rings[key] = e
+	}
+	ring := e.Value.(*flightRing)
+	if evicted := ring.push(recorded); evicted != nil {
+		r.bytes -= evicted.size
+		evicted.Recycle()
+	}
+	r.bytes += recorded.size
+
+	// evict the oldest logs of the least recently used logids
+	for r.bytes > r.maxBytes {
+		back := r.lru.Back()
+		evicted := back.Value.(*flightRing).pop()
+		if evicted == nil {
+			r.removeRing(back)
+			continue
+		}
+		r.bytes -= evicted.size
+		evicted.Recycle()
+	}
+}
+
+// take removes the recorded logs of the key and returns them in order.
+func (r *FlightRecorder) take(key string) []*recordedLog {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.rings[key]
+	if !ok {
+		return nil
+	}
+	logs := e.Value.(*flightRing).drain()
+	r.removeRing(e)
+	for _, recorded := range logs {
+		r.bytes -= recorded.size
+		recorded.markReplay()
+	}
+	return logs
+}
+
+func (r *FlightRecorder) removeRing(e *list.Element) {
+	ring := e.Value.(*flightRing)
+	for _, recorded := range ring.drain() {
+		r.bytes -= recorded.size
+		recorded.Recycle()
+	}
+	r.lru.Remove(e)
+	delete(r.rings, ring.key)
+}
+
+// flightRing is a circular buffer of the recorded logs.
+type flightRing struct {
+	key   string
+	logs  []*recordedLog
+	start int
+	size  int
+}
+
+func newFlightRing(key string, capacity int) *flightRing {
+	return &flightRing{key: key, logs: make([]*recordedLog, capacity)}
+}
+
+// push appends the log and returns the evicted one if the ring is full.
+func (r *flightRing) push(log *recordedLog) *recordedLog {
+	if r.size < len(r.logs) {
+		r.logs[(r.start+r.size)%len(r.logs)] = log
+		r.size++
+		return nil
+	}
+	evicted := r.logs[r.start]
+	r.logs[r.start] = log
+	r.start = (r.start + 1) % len(r.logs)
+	return evicted
+}
+
+// pop removes the oldest log.
+func (r *flightRing) pop() *recordedLog {
+	if r.size == 0 {
+		return nil
+	}
+	log := r.logs[r.start]
+	r.logs[r.start] = nil
+	r.start = (r.start + 1) % len(r.logs)
+	r.size--
+	return log
+}
+
+// drain removes all the logs and returns them in order, the logs are not recycled.
+func (r *flightRing) drain() []*recordedLog {
+	logs := make([]*recordedLog, 0, r.size)
+	for log := r.pop(); log != nil; log = r.pop() {
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// recordedLog is a copy of the log kept by FlightRecorder, the context is rebuilt only with the logid and spanid.
+type recordedLog struct {
+	data        []byte // body | location | content
+	bodyLen     int
+	locationLen int
+	time        osTime.Time
+	level       string
+	psm         string
+	logID       string
+	spanID      uint64
+	kvs         []*KeyValue
+	ctx         context.Context
+	size        int
+}
+
+func newRecordedLog(log RecyclableLog) *recordedLog {
+	body, location, content := log.GetBody(), log.GetLocation(), log.GetContent()
+	r := &recordedLog{
+		data:        make([]byte, 0, len(body)+len(location)+len(content)+len(flightReplayMark)),
+		bodyLen:     len(body),
+		locationLen: len(location),
+		time:        log.GetTime(),
+		level:       log.GetLevel(),
+		psm:         string(append([]byte(nil), log.GetPSM()...)), // the psm of the log may be reused
+		logID:       logIDFromContext(log.GetContext()),
+		spanID:      spanIDFromContext(log.GetContext()),
+	}
+	r.data = append(r.data, body...)
+	r.data = append(r.data, location...)
+	r.data = append(r.data, content...)
+	r.size = cap(r.data) + flightLogOverhead
+	if kvs := log.GetKVList(); len(kvs) > 0 {
+		r.kvs = make([]*KeyValue, 0, len(kvs)+1)
+		for _, kv := range kvs {
+			r.kvs = append(r.kvs, kv.Clone())
+			r.size += kv.Size()
+		}
+	}
+	return r
+}
+
+// markReplay marks the log as replayed in the content and KV list.
+func (r *recordedLog) markReplay() {
+	r.data = append(r.data, flightReplayMark...)
+	r.kvs = append(r.kvs, NewStrKeyValue(FlightReplayKey, "true"))
+	r.ctx = context.Background()
+	if r.logID != "-" {
+		r.ctx = context.WithValue(r.ctx, ContextLogIDKey, r.logID)
+	}
+	if r.spanID != 0 {
+		r.ctx = context.WithValue(r.ctx, ContextSpanIDKey, r.spanID)
+	}
+}
+
+func (r *recordedLog) Recycle() {
+	for _, kv := range r.kvs {
+		kv.Recycle()
+	}
+	r.kvs = nil
+}
+
+func (r *recordedLog) GetContent() []byte          { return r.data[r.bodyLen+r.locationLen:] }
+func (r *recordedLog) GetBody() []byte             { return r.data[:r.bodyLen] }
+func (r *recordedLog) GetTime() osTime.Time        { return r.time }
+func (r *recordedLog) GetLine() string             { return string(r.GetLocation()) }
+func (r *recordedLog) GetLevel() string            { return r.level }
+func (r *recordedLog) GetContext() context.Context { return r.ctx }
+func (r *recordedLog) GetLocation() []byte         { return r.data[r.bodyLen : r.bodyLen+r.locationLen] }
+func (r *recordedLog) GetPSM() string              { return r.psm }
+func (r *recordedLog) GetKVList() []*KeyValue      { return r.kvs }
+func (r *recordedLog) GetKVListStr() []string {
+	res := make([]string, len(r.kvs)*2)
+	for i, kv := range r.kvs {
+		res[2*i], res[2*i+1] = kv.ToKV()
+	}
+	return res
+}
+
+type FlightRecorderOption func(*FlightRecorder)
+
+// SetFlightLevel sets the level of the logs written directly, the logs below it are recorded, Info by default.
+func SetFlightLevel(level string) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		r.level = levelOrder(level)
+	}
+}
+
+// SetFlightTriggerLevel sets the level of the logs triggering the replay, Error by default.
+func SetFlightTriggerLevel(level string) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		r.triggerLevel = levelOrder(level)
+	}
+}
+
+// SetFlightPerLogID sets whether to record the logs per logid, true by default.
+// If it is false, all the logs are recorded in one buffer and any error log replays them.
+func SetFlightPerLogID(perLogID bool) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		r.perLogID = perLogID
+	}
+}
+
+// SetFlightCapacity sets the max count of the recorded logs per logid, 128 by default.
+func SetFlightCapacity(capacity int) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		if capacity > 0 {
+			r.capacity = capacity
+		}
+	}
+}
+
+// SetFlightMaxLogIDs sets the max count of the recorded logids, 1024 by default.
+func SetFlightMaxLogIDs(maxLogIDs int) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		if maxLogIDs > 0 {
+			r.maxRings = maxLogIDs
+		}
+	}
+}
+
+// SetFlightMaxBytes sets the max memory of the recorded logs in total, 16MB by default.
+func SetFlightMaxBytes(maxBytes int) FlightRecorderOption {
+	return func(r *FlightRecorder) {
+		if maxBytes > 0 {
+			r.maxBytes = maxBytes
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package writer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFlightLog(level, body, logID string) *testLog {
+	log := newTestLog(level, body, NewStrKeyValue("k", body))
+	log.ctx = context.WithValue(context.Background(), ContextLogIDKey, logID)
+	return log
+}
+
+func TestFlightRecorder_Replay(t *testing.T) {
+	fw := &flakyWriter{}
+	r := NewFlightRecorder(fw)
+
+	debug := newFlightLog("Debug", "debug 1", "logid-1")
+	assert.Nil(t, r.Write(debug))
+	assert.Equal(t, 1, debug.recycled)
+	assert.Nil(t, r.Write(newFlightLog("Trace", "trace 1", "logid-1")))
+	assert.Nil(t, r.Write(newFlightLog("Debug", "debug 2", "logid-2")))
+	assert.Nil(t, r.Write(newFlightLog("Info", "info 1", "logid-1")))
+	assert.Equal(t, []string{"info 1"}, fw.received())
+
+	assert.Nil(t, r.Write(newFlightLog("Error", "error 1", "logid-1")))
+	assert.Equal(t, []string{"info 1", "debug 1", "trace 1", "error 1"}, fw.received())
+	assert.Equal(t, "Debug debug 1 _replay=true", fw.content[1])
+	assert.Equal(t, []string{"k", "debug 1", FlightReplayKey, "true"}, fw.kvs[1])
+	assert.Equal(t, "logid-1", fw.logIDs[1])
+	assert.Equal(t, "Error error 1", fw.content[3])
+
+	// the history is replayed only once
+	assert.Nil(t, r.Write(newFlightLog("Error", "error 2", "logid-1")))
+	assert.Equal(t, 5, len(fw.received()))
+
+	assert.Nil(t, r.Write(newFlightLog("Fatal", "fatal", "logid-2")))
+	assert.Equal(t, []string{"debug 2", "fatal"}, fw.received()[5:])
+	assert.Equal(t, 0, r.bytes)
+	assert.Nil(t, r.Close())
+}
+
+func TestFlightRecorder_Bounded(t *testing.T) {
+	fw := &flakyWriter{}
+	r := NewFlightRecorder(fw, SetFlightCapacity(3), SetFlightMaxLogIDs(2))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, r.Write(newFlightLog("Debug", "a"+strconv.Itoa(i), "logid-a")))
+	}
+	assert.Nil(t, r.Write(newFlightLog("Debug", "b", "logid-b")))
+	assert.Nil(t, r.Write(newFlightLog("Debug", "c", "logid-c")))
+	assert.Equal(t, 2, len(r.rings))
+
+	// logid-a is evicted as the least recently used one
+	assert.Nil(t, r.Write(newFlightLog("Error", "error a", "logid-a")))
+	assert.Equal(t, []string{"error a"}, fw.received())
+
+	assert.Nil(t, r.Write(newFlightLog("Error", "error b", "logid-b")))
+	assert.Equal(t, []string{"error a", "b", "error b"}, fw.received())
+
+	// only the latest logs are kept
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, r.Write(newFlightLog("Debug", "d"+strconv.Itoa(i), "logid-d")))
+	}
+	assert.Nil(t, r.Write(newFlightLog("Error", "error d", "logid-d")))
+	assert.Equal(t, []string{"d2", "d3", "d4", "error d"}, fw.received()[3:])
+
+	// the max bytes in total
+	r = NewFlightRecorder(fw, SetFlightMaxBytes(1000))
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, r.Write(newFlightLog("Debug", "e"+strconv.Itoa(i), "logid-e")))
+		assert.LessOrEqual(t, r.bytes, 1000)
+	}
+	assert.Greater(t, r.bytes, 0)
+}
+
+func TestFlightRecorder_Global(t *testing.T) {
+	fw := &flakyWriter{}
+	r := NewFlightRecorder(fw, SetFlightPerLogID(false), SetFlightLevel("Warn"), SetFlightTriggerLevel("Fatal"))
+
+	assert.Nil(t, r.Write(newFlightLog("Info", "info", "logid-1")))
+	assert.Nil(t, r.Write(newFlightLog("Debug", "debug", "logid-2")))
+	assert.Nil(t, r.Write(newFlightLog("Error", "error", "logid-3")))
+	assert.Equal(t, []string{"error"}, fw.received())
+
+	assert.Nil(t, r.Write(newFlightLog("Fatal", "fatal", "logid-4")))
+	assert.Equal(t, []string{"error", "info", "debug", "fatal"}, fw.received())
+	assert.Equal(t, []string{"logid-3", "logid-1", "logid-2", "logid-4"}, fw.logIDs)
+}
@@ -0,0 +1,384 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	osTime "time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultHTTPBatchSize     = 1 << 20 // 1MB
+	defaultHTTPFlushInterval = osTime.Second
+	defaultHTTPQueueSize     = 8
+	defaultHTTPMaxRetries    = 3
+	defaultHTTPMinBackoff    = 100 * osTime.Millisecond
+	defaultHTTPMaxBackoff    = 5 * osTime.Second
+	defaultHTTPTimeout       = 10 * osTime.Second
+	defaultHTTPCloseTimeout  = 5 * osTime.Second
+)
+
+var (
+	ErrHTTPQueueFull    = errors.New("http writer queue is full")
+	ErrHTTPFlushTimeout = errors.New("http writer flush timeout")
+)
+
+// HTTPStatusError is returned if the endpoint responds a non-2xx status.
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http writer gets unexpected status %d", e.StatusCode)
+}
+
+// HTTPWriter posts the logs to an HTTP ingestion endpoint,
+// the logs are encoded to NDJSON by JSONEncoder and batched by size and time,
+// each batch is compressed by gzip and retried with an exponential backoff on 5xx and network errors.
+// It sends the batches in the background, it does not need to be wrapped with AsyncWriter.
+type HTTPWriter struct {
+	url           string
+	client        *http.Client
+	header        http.Header
+	encoder       Encoder
+	batchSize     int
+	flushInterval osTime.Duration
+	queueSize     int
+	maxRetries    int
+	minBackoff    osTime.Duration
+	maxBackoff    osTime.Duration
+	gzip          bool
+	closeTimeout  osTime.Duration
+
+	lock    sync.Mutex
+	buf     []byte
+	count   int
+	closed  bool
+	batches chan *httpBatch
+	lastErr error
+	dropped uint64
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+	errorPrint *rate.Limiter
+}
+
+// httpBatch is a NDJSON batch, done is set by Flush to get the result of the batches before it.
+type httpBatch struct {
+	data  []byte
+	count int
+	done  chan error
+}
+
+// NewHTTPWriter creates a HTTPWriter which posts the logs to url.
+func NewHTTPWriter(url string, options ...HTTPOption) LogWriter {
+	w := &HTTPWriter{
+		url:           url,
+		client:        &http.Client{Timeout: defaultHTTPTimeout},
+		header:        make(http.Header),
+		encoder:       NewJSONEncoder(),
+		batchSize:     defaultHTTPBatchSize,
+		flushInterval: defaultHTTPFlushInterval,
+		queueSize:     defaultHTTPQueueSize,
+		maxRetries:    defaultHTTPMaxRetries,
+		minBackoff:    defaultHTTPMinBackoff,
+		maxBackoff:    defaultHTTPMaxBackoff,
+		gzip:          true,
+		closeTimeout:  defaultHTTPCloseTimeout,
+		errorPrint:    rate.NewLimiter(rate.Every(osTime.Second), 1),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	w.batches = make(chan *httpBatch, w.queueSize)
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.background.Add(1)
+	go w.runSender()
+	return w
+}
+
+// Dropped returns the count of the logs dropped since the writer is created.
+func (w *HTTPWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *HTTPWriter) Write(log RecyclableLog) error {
+	defer log.Recycle()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		atomic.AddUint64(&w.dropped, 1)
+		return nil
+	}
+	// the log is encoded into the batch buffer, nothing refers to the pooled log after Recycle.
+	w.buf = w.encoder.Encode(w.buf, log)
+	w.buf = append(w.buf, '\n')
+	w.count++
+	if len(w.buf) < w.batchSize {
+		return nil
+	}
+	batch := w.cutLocked()
+	select {
+	case w.batches <- batch:
+		return nil
+	default:
+		atomic.AddUint64(&w.dropped, uint64(batch.count))
+		return ErrHTTPQueueFull
+	}
+}
+
+// Flush sends the buffered logs and waits for the queued batches,
+// it returns the first error since the last flush.
+func (w *HTTPWriter) Flush() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	batch := w.cutLocked()
+	w.lock.Unlock()
+	return w.waitBatch(batch, w.closeTimeout)
+}
+
+// Close sends the buffered logs and stops the sender, it waits for 5 seconds at most by default.
+func (w *HTTPWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	batch := w.cutLocked()
+	w.lock.Unlock()
+
+	err := w.waitBatch(batch, w.closeTimeout)
+	// abort the request and the backoff in progress
+	w.cancel()
+	w.background.Wait()
+	return err
+}
+
+// cutLocked takes the buffered logs as a batch, the lock must be held.
+func (w *HTTPWriter) cutLocked() *httpBatch {
+	batch := &httpBatch{data: w.buf, count: w.count}
+	w.buf = make([]byte, 0, len(w.buf))
+	w.count = 0
+	return batch
+}
+
+func (w *HTTPWriter) waitBatch(batch *httpBatch, timeout osTime.Duration) error {
+	batch.done = make(chan error, 1)
+	timer := osTime.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case w.batches <- batch:
+	case <-timer.C:
+		atomic.AddUint64(&w.dropped, uint64(batch.count))
+		return ErrHTTPFlushTimeout
+	}
+	select {
+	case err := <-batch.done:
+		return err
+	case <-timer.C:
+		return ErrHTTPFlushTimeout
+	}
+}
+
+func (w *HTTPWriter) runSender() {
+	defer w.background.Done()
+	ticker := osTime.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case batch := <-w.batches:
+			w.send(batch)
+		case <-ticker.C:
+			w.lock.Lock()
+			var batch *httpBatch
+			if w.count > 0 {
+				batch = w.cutLocked()
+			}
+			w.lock.Unlock()
+			if batch != nil {
+				w.send(batch)
+			}
+		case <-w.ctx.Done():
+			for i := len(w.batches); i > 0; i-- {
+				batch := <-w.batches
+				atomic.AddUint64(&w.dropped, uint64(batch.count))
+				if batch.done != nil {
+					batch.done <- w.ctx.Err()
+				}
+			}
+			return
+		}
+	}
+}
+
+func (w *HTTPWriter) send(batch *httpBatch) {
+	if batch.count > 0 {
+		if err := w.post(batch.data); err != nil {
+			atomic.AddUint64(&w.dropped, uint64(batch.count))
+			if w.lastErr == nil {
+				w.lastErr = err
+			}
+			if w.errorPrint.Allow() {
+				_, _ = fmt.Fprintf(os.Stderr, "log http writer posts %d logs error: %s\n", batch.count, err)
+			}
+		}
+	}
+	if batch.done != nil {
+		batch.done <- w.lastErr
+		w.lastErr = nil
+	}
+}
+
+// post sends the data and retries on 5xx and network errors.
+func (w *HTTPWriter) post(data []byte) error {
+	body := data
+	if w.gzip {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		_, _ = gz.Write(data)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = compressed.Bytes()
+	}
+
+	backoff := w.minBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.postOnce(body)
+		if err == nil || !retryable || attempt >= w.maxRetries {
+			return err
+		}
+		timer := osTime.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-w.ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if backoff *= 2; backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+func (w *HTTPWriter) postOnce(body []byte) (retryable bool, err error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return w.ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, &HTTPStatusError{StatusCode: resp.StatusCode}
+}
+
+type HTTPOption func(*HTTPWriter)
+
+// SetHTTPClient sets the client to post logs, the default client has a 10 seconds timeout.
+func SetHTTPClient(client *http.Client) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.client = client
+	}
+}
+
+// SetHTTPHeader adds a header to every request.
+func SetHTTPHeader(key, value string) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.header.Add(key, value)
+	}
+}
+
+// SetHTTPBasicAuth sets the basic authorization of requests.
+func SetHTTPBasicAuth(username, password string) HTTPOption {
+	return func(writer *HTTPWriter) {
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(username, password)
+		writer.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+}
+
+// SetHTTPEncoder sets the encoder of each line, the default is JSONEncoder.
+func SetHTTPEncoder(encoder Encoder) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.encoder = encoder
+	}
+}
+
+// SetHTTPBatchSize sets the bytes of a batch before compression, the default is 1MB.
+func SetHTTPBatchSize(size int) HTTPOption {
+	return func(writer *HTTPWriter) {
+		if size > 0 {
+			writer.batchSize = size
+		}
+	}
+}
+
+// SetHTTPFlushInterval sets the max interval to send a batch which is not full, the default is 1s.
+func SetHTTPFlushInterval(interval osTime.Duration) HTTPOption {
+	return func(writer *HTTPWriter) {
+		if interval > 0 {
+			writer.flushInterval = interval
+		}
+	}
+}
+
+// SetHTTPQueueSize sets the count of batches waiting to be sent, the batch is dropped if the queue is full.
+func SetHTTPQueueSize(size int) HTTPOption {
+	return func(writer *HTTPWriter) {
+		if size > 0 {
+			writer.queueSize = size
+		}
+	}
+}
+
+// SetHTTPRetry sets the max retries and the exponential backoff between them,
+// the default is 3 retries with the backoff from 100ms to 5s.
+func SetHTTPRetry(maxRetries int, minBackoff, maxBackoff osTime.Duration) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.maxRetries = maxRetries
+		writer.minBackoff = minBackoff
+		writer.maxBackoff = maxBackoff
+	}
+}
+
+// SetHTTPGzip sets whether to compress the request body, it is enabled by default.
+func SetHTTPGzip(enable bool) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.gzip = enable
+	}
+}
+
+// SetHTTPCloseTimeout sets how long Flush and Close wait for the sending, the default is 5s.
+func SetHTTPCloseTimeout(timeout osTime.Duration) HTTPOption {
+	return func(writer *HTTPWriter) {
+		writer.closeTimeout = timeout
+	}
+}
@@ -0,0 +1,132 @@
+package writer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ingestServer struct {
+	*httptest.Server
+	sync.Mutex
+	requests int32
+	lines    []map[string]interface{}
+	header   http.Header
+	statuses []int
+}
+
+func newIngestServer(t *testing.T, statuses ...int) *ingestServer {
+	s := &ingestServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		n := int(atomic.AddInt32(&s.requests, 1))
+		if n <= len(s.statuses) {
+			rw.WriteHeader(s.statuses[n-1])
+			return
+		}
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(req.Body)
+			assert.Nil(t, err)
+			body = gz
+		}
+		s.Lock()
+		defer s.Unlock()
+		s.header = req.Header
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+			s.lines = append(s.lines, line)
+		}
+	}))
+	return s
+}
+
+func (s *ingestServer) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.lines)
+}
+
+func TestHTTPWriter_Batch(t *testing.T) {
+	s := newIngestServer(t)
+	defer s.Close()
+
+	w := NewHTTPWriter(s.URL, SetHTTPBatchSize(1024), SetHTTPQueueSize(100), SetHTTPFlushInterval(osTime.Hour),
+		SetHTTPHeader("X-Token", "abc"), SetHTTPBasicAuth("user", "pass"))
+	for i := 0; i < 100; i++ {
+		log := newTestLog("Info", "hello", NewOmniKeyValue("i", i))
+		assert.Nil(t, w.Write(log))
+		// the writer must not refer to the pooled log after Recycle.
+		copy(log.body, "xxxxx")
+		assert.Equal(t, 1, log.recycled)
+	}
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, 100, s.count())
+	assert.Less(t, int32(1), atomic.LoadInt32(&s.requests))
+	for i, line := range s.lines {
+		assert.Equal(t, "hello", line[MessageFieldKey])
+		assert.Equal(t, float64(i), line["i"])
+	}
+	assert.Equal(t, "abc", s.header.Get("X-Token"))
+	assert.Equal(t, "application/x-ndjson", s.header.Get("Content-Type"))
+	assert.Equal(t, "Basic dXNlcjpwYXNz", s.header.Get("Authorization"))
+
+	// Close sends the buffered logs and drops the logs after it.
+	assert.Nil(t, w.Write(newTestLog("Info", "last")))
+	assert.Nil(t, w.Close())
+	assert.Nil(t, w.Write(newTestLog("Info", "dropped")))
+	assert.Equal(t, 101, s.count())
+	assert.Equal(t, uint64(1), w.(*HTTPWriter).Dropped())
+}
+
+func TestHTTPWriter_FlushInterval(t *testing.T) {
+	s := newIngestServer(t)
+	defer s.Close()
+
+	w := NewHTTPWriter(s.URL, SetHTTPFlushInterval(10*osTime.Millisecond), SetHTTPGzip(false))
+	defer w.Close()
+	assert.Nil(t, w.Write(newTestLog("Info", "hello")))
+	assert.Eventually(t, func() bool { return s.count() == 1 }, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Equal(t, "", s.header.Get("Content-Encoding"))
+}
+
+func TestHTTPWriter_Retry(t *testing.T) {
+	s := newIngestServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	defer s.Close()
+
+	w := NewHTTPWriter(s.URL, SetHTTPRetry(3, osTime.Millisecond, 5*osTime.Millisecond))
+	assert.Nil(t, w.Write(newTestLog("Info", "hello")))
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&s.requests))
+	assert.Equal(t, 1, s.count())
+	assert.Nil(t, w.Close())
+
+	// 4xx is not retried
+	s = newIngestServer(t, http.StatusBadRequest)
+	defer s.Close()
+	w = NewHTTPWriter(s.URL, SetHTTPRetry(3, osTime.Millisecond, 5*osTime.Millisecond))
+	assert.Nil(t, w.Write(newTestLog("Info", "hello")))
+	assert.Equal(t, &HTTPStatusError{StatusCode: http.StatusBadRequest}, w.Flush())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&s.requests))
+	assert.Equal(t, uint64(1), w.(*HTTPWriter).Dropped())
+	// the error is reported once
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.Close())
+
+	// network errors are retried until the max retries
+	s.Close()
+	w = NewHTTPWriter(s.URL, SetHTTPRetry(2, osTime.Millisecond, 5*osTime.Millisecond))
+	assert.Nil(t, w.Write(newTestLog("Info", "hello")))
+	assert.NotNil(t, w.Flush())
+	assert.Nil(t, w.Close())
+}
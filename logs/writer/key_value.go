@@ -475,36 +475,32 @@ func (kv *KeyValue) ToKV() (string, string) {
 func (kv *KeyValue) EncodeAsStr(buf []byte) []byte {
 	buf = append(buf, kv.Key...)
 	buf = append(buf, equalByte)
-	var valueStr string
+	return kv.AppendValueStr(buf)
+}
+
+// AppendValueStr appends the value in string format, e.g. "true", "100", "1.5".
+func (kv *KeyValue) AppendValueStr(buf []byte) []byte {
 	switch kv.ValueType {
 	case BoolType:
-		if len(kv.Value) > 0 && kv.Value[0] == 1 {
-			valueStr = "true"
-		} else {
-			valueStr = "false"
-		}
+		return strconv.AppendBool(buf, len(kv.Value) > 0 && kv.Value[0] == 1)
 	case IntType:
 		valInt, _ := DecodeUint32(kv.Value)
-		valueStr = strconv.FormatInt(int64(int32(valInt)), 10)
+		return strconv.AppendInt(buf, int64(int32(valInt)), 10)
 	case LongType:
 		valLong, _ := DecodeUint64(kv.Value)
-		valueStr = strconv.FormatInt(int64(valLong), 10)
+		return strconv.AppendInt(buf, int64(valLong), 10)
 	case Uint64Type:
 		valUint64, _ := DecodeUint64(kv.Value)
-		valueStr = strconv.FormatUint(valUint64, 10)
+		return strconv.AppendUint(buf, valUint64, 10)
 	case DoubleType:
 		valInt64, _ := DecodeUint64(kv.Value)
 		valDouble := math.Float64frombits(valInt64)
-		valueStr = strconv.FormatFloat(valDouble, 'f', -1, 64)
+		return strconv.AppendFloat(buf, valDouble, 'f', -1, 64)
 	case BytesType:
-		valueStr = fmt.Sprintf("%v", kv.Value)
-	case StringType, TextType:
-		valueStr = SliceByteToString(kv.Value)
+		return append(buf, fmt.Sprintf("%v", kv.Value)...)
 	default:
-		valueStr = string(kv.Value)
+		return append(buf, kv.Value...)
 	}
-	buf = append(buf, valueStr...)
-	return buf
 }
 
 func (kv *KeyValue) Clone() *KeyValue {
@@ -0,0 +1,323 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The spool is a queue of segment files in a directory, each record is framed as:
+//
+//	| data length uint32 | crc32 of data uint32 | data |
+//
+// the read position is persisted in the offset file, so the queue survives restarts.
+const (
+	spoolSegmentSuffix     = ".seg"
+	spoolOffsetFilename    = "spool.offset"
+	spoolRecordHeaderSize  = 8
+	spoolSegmentNameFormat = "%020d" + spoolSegmentSuffix
+)
+
+var errSpoolCorrupted = errors.New("spool record is corrupted")
+
+type spoolQueue struct {
+	sync.Mutex
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	segments  []int64 // seqs of the segments in ascending order
+	sizes     map[int64]int64
+	totalSize int64
+	tail      *os.File
+	tailSeq   int64
+
+	reader     *os.File
+	readSeq    int64
+	readOffset int64
+	offsetFile *os.File
+	writeBuf   []byte
+	readBuf    []byte
+
+	droppedSegments uint64
+}
+
+func openSpoolQueue(dir string, segmentSize, maxSize int64) (*spoolQueue, error) {
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return nil, err
+	}
+	q := &spoolQueue{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxSize:     maxSize,
+		sizes:       make(map[int64]int64),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seq)
+		q.sizes[seq] = info.Size()
+		q.totalSize += info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		if err := q.openTail(1); err != nil {
+			return nil, err
+		}
+	} else {
+		seq := q.segments[len(q.segments)-1]
+		// the process may crash in the middle of appending, truncate the partial record.
+		if err := q.truncateSegment(seq); err != nil {
+			return nil, err
+		}
+		tail, err := os.OpenFile(q.segmentName(seq), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		q.tail, q.tailSeq = tail, seq
+	}
+
+	if q.offsetFile, err = os.OpenFile(filepath.Join(dir, spoolOffsetFilename), os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return nil, err
+	}
+	var offset [16]byte
+	if n, _ := q.offsetFile.ReadAt(offset[:], 0); n == len(offset) {
+		seq, _ := DecodeUint64(offset[:8])
+		pos, _ := DecodeUint64(offset[8:])
+		q.readSeq, q.readOffset = int64(seq), int64(pos)
+	}
+	if _, ok := q.sizes[q.readSeq]; !ok || q.sizes[q.readSeq] < q.readOffset {
+		q.readSeq, q.readOffset = q.segments[0], 0
+	}
+	// the consumed segments may be left if the process exits before removing them.
+	for q.segments[0] != q.readSeq {
+		q.removeHead()
+	}
+	return q, nil
+}
+
+func (q *spoolQueue) segmentName(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf(spoolSegmentNameFormat, seq))
+}
+
+func (q *spoolQueue) openTail(seq int64) error {
+	tail, err := os.OpenFile(q.segmentName(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.tail, q.tailSeq = tail, seq
+	q.segments = append(q.segments, seq)
+	q.sizes[seq] = 0
+	return nil
+}
+
+// truncateSegment removes the partial record at the end of the segment.
+func (q *spoolQueue) truncateSegment(seq int64) error {
+	file, err := os.OpenFile(q.segmentName(seq), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size := q.sizes[seq]
+	var offset int64
+	var header [spoolRecordHeaderSize]byte
+	for offset < size {
+		if _, err := file.ReadAt(header[:], offset); err != nil {
+			break
+		}
+		length, _ := DecodeUint32(header[:4])
+		if offset+spoolRecordHeaderSize+int64(length) > size {
+			break
+		}
+		offset += spoolRecordHeaderSize + int64(length)
+	}
+	if offset == size {
+		return nil
+	}
+	q.totalSize -= size - offset
+	q.sizes[seq] = offset
+	return file.Truncate(offset)
+}
+
+// append appends a record to the tail segment, the oldest segments are dropped if it exceeds the max size.
+func (q *spoolQueue) append(data []byte) error {
+	q.Lock()
+	defer q.Unlock()
+	return q.appendLocked(data)
+}
+
+func (q *spoolQueue) appendLocked(data []byte) error {
+	size := int64(spoolRecordHeaderSize + len(data))
+	if q.sizes[q.tailSeq] > 0 && q.sizes[q.tailSeq]+size > q.segmentSize {
+		_ = q.tail.Close()
+		if err := q.openTail(q.tailSeq + 1); err != nil {
+			return err
+		}
+	}
+	q.writeBuf = EncodeUint32(q.writeBuf[:0], uint32(len(data)))
+	q.writeBuf = EncodeUint32(q.writeBuf, crc32.ChecksumIEEE(data))
+	q.writeBuf = append(q.writeBuf, data...)
+	n, err := q.tail.Write(q.writeBuf)
+	q.sizes[q.tailSeq] += int64(n)
+	q.totalSize += int64(n)
+	for q.maxSize > 0 && q.totalSize > q.maxSize && len(q.segments) > 1 {
+		q.droppedSegments++
+		q.removeHead()
+	}
+	return err
+}
+
+// removeHead removes the oldest segment which is not the tail, the reader moves to the next segment if it is reading it.
+func (q *spoolQueue) removeHead() {
+	seq := q.segments[0]
+	if q.readSeq == seq {
+		if q.reader != nil {
+			_ = q.reader.Close()
+			q.reader = nil
+		}
+		q.readSeq, q.readOffset = q.segments[1], 0
+		q.saveOffset()
+	}
+	_ = os.Remove(q.segmentName(seq))
+	q.totalSize -= q.sizes[seq]
+	delete(q.sizes, seq)
+	q.segments = q.segments[1:]
+}
+
+// spoolPosition is the read position of a record returned by peek.
+type spoolPosition struct {
+	seq    int64
+	offset int64
+}
+
+// peek returns the record at the read position and the position, io.EOF is returned if the queue is empty,
+// the returned data is valid until the next peek.
+func (q *spoolQueue) peek() ([]byte, spoolPosition, error) {
+	q.Lock()
+	defer q.Unlock()
+	return q.peekLocked()
+}
+
+func (q *spoolQueue) peekLocked() ([]byte, spoolPosition, error) {
+	for {
+		pos := spoolPosition{seq: q.readSeq, offset: q.readOffset}
+		if q.readSeq == q.tailSeq && q.readOffset >= q.sizes[q.tailSeq] {
+			return nil, pos, io.EOF
+		}
+		if q.readOffset >= q.sizes[q.readSeq] {
+			// the segment is consumed
+			q.removeHead()
+			continue
+		}
+		data, err := q.readRecord()
+		if err == errSpoolCorrupted && q.readSeq != q.tailSeq {
+			// skip the rest of the corrupted segment
+			q.removeHead()
+			continue
+		}
+		return data, pos, err
+	}
+}
+
+func (q *spoolQueue) readRecord() ([]byte, error) {
+	if q.reader == nil {
+		reader, err := os.Open(q.segmentName(q.readSeq))
+		if err != nil {
+			return nil, err
+		}
+		q.reader = reader
+	}
+	var header [spoolRecordHeaderSize]byte
+	if _, err := q.reader.ReadAt(header[:], q.readOffset); err != nil {
+		return nil, errSpoolCorrupted
+	}
+	length, _ := DecodeUint32(header[:4])
+	checksum, _ := DecodeUint32(header[4:])
+	if q.readOffset+spoolRecordHeaderSize+int64(length) > q.sizes[q.readSeq] {
+		return nil, errSpoolCorrupted
+	}
+	if cap(q.readBuf) < int(length) {
+		q.readBuf = make([]byte, length)
+	}
+	data := q.readBuf[:length]
+	if _, err := q.reader.ReadAt(data, q.readOffset+spoolRecordHeaderSize); err != nil {
+		return nil, errSpoolCorrupted
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, errSpoolCorrupted
+	}
+	return data, nil
+}
+
+// commit moves the read position after the record returned by peek at the position.
+// It does nothing if the read position has moved, e.g. the segment of the record is dropped for the max size.
+func (q *spoolQueue) commit(pos spoolPosition, data []byte) {
+	q.Lock()
+	defer q.Unlock()
+	if q.readSeq != pos.seq || q.readOffset != pos.offset {
+		return
+	}
+	q.readOffset += int64(spoolRecordHeaderSize + len(data))
+	q.saveOffset()
+}
+
+// skip moves the read position after a bad record at the position in the tail segment,
+// or drops the segment of the record if it is not the tail. Like commit, it does nothing if the read position has moved.
+func (q *spoolQueue) skip(pos spoolPosition) {
+	q.Lock()
+	defer q.Unlock()
+	if q.readSeq != pos.seq || q.readOffset != pos.offset {
+		return
+	}
+	if q.readSeq == q.tailSeq {
+		q.readOffset = q.sizes[q.tailSeq]
+	} else {
+		q.removeHead()
+	}
+	q.saveOffset()
+}
+
+func (q *spoolQueue) saveOffset() {
+	var offset [16]byte
+	WriteUint64(offset[:], 0, uint64(q.readSeq))
+	WriteUint64(offset[:], 8, uint64(q.readOffset))
+	_, _ = q.offsetFile.WriteAt(offset[:], 0)
+}
+
+func (q *spoolQueue) empty() bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.readSeq == q.tailSeq && q.readOffset >= q.sizes[q.tailSeq]
+}
+
+func (q *spoolQueue) close() error {
+	q.Lock()
+	defer q.Unlock()
+	if q.reader != nil {
+		_ = q.reader.Close()
+	}
+	_ = q.offsetFile.Close()
+	return q.tail.Close()
+}
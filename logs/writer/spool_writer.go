@@ -0,0 +1,475 @@
+package writer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	osTime "time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultSpoolSegmentSize   = 4 << 20   // 4MB
+	defaultSpoolMaxDiskSize   = 256 << 20 // 256MB
+	defaultSpoolChanSize      = 1024
+	defaultSpoolRetryInterval = osTime.Second
+
+	spoolContentKey = "_content"
+)
+
+// SpoolWriter wraps another writer and spools the logs to a bounded on-disk queue
+// if the writer fails or the buffer overflows, the spooled logs are replayed in order once the writer recovers.
+// The queue is persisted in a directory, so the logs survive process restarts.
+//
+// The logs are written in a background goroutine like AsyncWriter, so the user goroutine is not blocked
+// by the writer or the replaying. After a failure or an overflow, the following logs are spooled as well to keep the order,
+// until the replaying catches up.
+type SpoolWriter struct {
+	LogWriter
+	queue         *spoolQueue
+	ch            chan spoolEntry
+	sendLock      sync.RWMutex // held exclusively when the overflowed logs are spooled
+	flush         chan chan error
+	spooled       chan struct{}
+	done          chan struct{}
+	closed        int32
+	pending       sync.WaitGroup
+	background    sync.WaitGroup
+	healthy       int32
+	chanSize      int
+	segmentSize   int64
+	maxDiskSize   int64
+	retryInterval osTime.Duration
+	healthCheck   func() error
+	errorPrint    *rate.Limiter
+}
+
+// NewSpoolWriter creates a SpoolWriter which spools the logs to dir, it panics if the dir cannot be opened.
+func NewSpoolWriter(w LogWriter, dir string, options ...SpoolOption) LogWriter {
+	spoolWriter := &SpoolWriter{
+		LogWriter:     w,
+		flush:         make(chan chan error),
+		spooled:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		chanSize:      defaultSpoolChanSize,
+		segmentSize:   defaultSpoolSegmentSize,
+		maxDiskSize:   defaultSpoolMaxDiskSize,
+		retryInterval: defaultSpoolRetryInterval,
+		errorPrint:    rate.NewLimiter(rate.Every(osTime.Second), 1),
+	}
+	for _, op := range options {
+		op(spoolWriter)
+	}
+	queue, err := openSpoolQueue(dir, spoolWriter.segmentSize, spoolWriter.maxDiskSize)
+	if err != nil {
+		panic(err)
+	}
+	spoolWriter.queue = queue
+	spoolWriter.ch = make(chan spoolEntry, spoolWriter.chanSize)
+	if queue.empty() {
+		spoolWriter.healthy = 1
+	}
+	spoolWriter.background.Add(2)
+	go spoolWriter.runWorker()
+	go spoolWriter.runReplayer()
+	return spoolWriter
+}
+
+func (w *SpoolWriter) Write(log RecyclableLog) error {
+	if atomic.LoadInt32(&w.closed) == 1 {
+		return w.spool(log)
+	}
+	w.sendLock.RLock()
+	w.pending.Add(1)
+	select {
+	case w.ch <- spoolEntry{log: log}:
+		w.sendLock.RUnlock()
+		return nil
+	default:
+		w.pending.Done()
+		w.sendLock.RUnlock()
+		w.overflow(log)
+		return nil
+	}
+}
+
+// spoolEntry is a buffered log, or the records spooled on overflow which are appended to the spool by the worker,
+// so they are behind the log being written by the worker.
+type spoolEntry struct {
+	log     RecyclableLog
+	records [][]byte
+}
+
+// overflow spools the buffered logs and the log in order, and the following logs are spooled behind them
+// until the replaying catches up, so the writer is never written by the worker and the replayer at the same time.
+func (w *SpoolWriter) overflow(log RecyclableLog) {
+	// no logs are buffered by others meanwhile, so the buffered logs are all older than the log.
+	w.sendLock.Lock()
+	defer w.sendLock.Unlock()
+	w.queue.Lock()
+	atomic.StoreInt32(&w.healthy, 0)
+	w.queue.Unlock()
+
+	var records [][]byte
+	for drained := false; !drained; {
+		select {
+		case e := <-w.ch:
+			records = append(records, e.encode()...)
+			w.pending.Done()
+		default:
+			drained = true
+		}
+	}
+	records = append(records, spoolEntry{log: log}.encode()...)
+	w.pending.Add(1)
+	select {
+	case w.ch <- spoolEntry{records: records}:
+	case <-w.done:
+		w.pending.Done()
+		w.appendRecords(records)
+	}
+}
+
+// encode encodes the entry to spool records and recycles the log.
+func (e spoolEntry) encode() [][]byte {
+	if e.log == nil {
+		return e.records
+	}
+	defer e.log.Recycle()
+	return [][]byte{encodeSpoolRecord(nil, e.log)}
+}
+
+// Flush writes the buffered logs and flushes the writer, the spooled logs are not waited.
+func (w *SpoolWriter) Flush() error {
+	if atomic.LoadInt32(&w.closed) == 1 {
+		return nil
+	}
+	ack := make(chan error, 1)
+	select {
+	case w.flush <- ack:
+		return <-ack
+	case <-w.done:
+		return nil
+	}
+}
+
+// Close writes or spools the buffered logs in 1 second, the logs not replayed are kept in the spool.
+func (w *SpoolWriter) Close() error {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return nil
+	}
+	waitChan := make(chan bool, 1)
+	go func() {
+		w.pending.Wait()
+		waitChan <- true
+	}()
+	select {
+	case <-waitChan:
+	case <-osTime.After(closeTimeout):
+	}
+	close(w.done)
+	w.background.Wait()
+	// spool the logs left in the channel
+	for i := len(w.ch); i > 0; i-- {
+		w.appendRecords((<-w.ch).encode())
+		w.pending.Done()
+	}
+	err := w.LogWriter.Close()
+	if qErr := w.queue.close(); err == nil {
+		err = qErr
+	}
+	return err
+}
+
+func (w *SpoolWriter) runWorker() {
+	defer w.background.Done()
+	for {
+		select {
+		case e := <-w.ch:
+			w.writeEntry(e)
+			w.pending.Done()
+		case ack := <-w.flush:
+			for i := len(w.ch); i > 0; i-- {
+				w.writeEntry(<-w.ch)
+				w.pending.Done()
+			}
+			ack <- w.LogWriter.Flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *SpoolWriter) writeEntry(e spoolEntry) {
+	if e.log == nil {
+		w.appendRecords(e.records)
+		w.notifyReplayer()
+		return
+	}
+	w.writeLog(e.log)
+}
+
+// writeLog writes the log to the writer if it is healthy, otherwise spools it.
+func (w *SpoolWriter) writeLog(log RecyclableLog) {
+	if w.spoolIfUnhealthy(log) {
+		return
+	}
+	// the log is recycled by the writer, retain it to spool it on failure.
+	retained := retainLog(log)
+	defer retained.Recycle()
+	if err := w.LogWriter.Write(retained); err != nil {
+		atomic.StoreInt32(&w.healthy, 0)
+		if w.errorPrint.Allow() {
+			_, _ = fmt.Fprintf(os.Stderr, "log spool writer spools logs since writes error: %s\n", err)
+		}
+		record := NewPacket(0)
+		defer PutPacket(record)
+		*record = encodeSpoolRecord(*record, log)
+		_ = w.appendRecord(*record)
+	}
+}
+
+// spoolIfUnhealthy spools the log if the writer is unhealthy,
+// it is checked with the queue locked, so the log is not left behind by the replaying.
+func (w *SpoolWriter) spoolIfUnhealthy(log RecyclableLog) bool {
+	if atomic.LoadInt32(&w.healthy) == 1 {
+		return false
+	}
+	w.queue.Lock()
+	defer w.queue.Unlock()
+	if atomic.LoadInt32(&w.healthy) == 1 {
+		return false
+	}
+	defer log.Recycle()
+	record := NewPacket(0)
+	defer PutPacket(record)
+	*record = encodeSpoolRecord(*record, log)
+	if err := w.queue.appendLocked(*record); err != nil && w.errorPrint.Allow() {
+		_, _ = fmt.Fprintf(os.Stderr, "log spool writer appends error: %s\n", err)
+	}
+	return true
+}
+
+func (w *SpoolWriter) spool(log RecyclableLog) error {
+	defer log.Recycle()
+	record := NewPacket(0)
+	defer PutPacket(record)
+	*record = encodeSpoolRecord(*record, log)
+	return w.appendRecord(*record)
+}
+
+// appendRecords appends the records spooled on overflow, the writer is unhealthy until the replaying catches up them.
+func (w *SpoolWriter) appendRecords(records [][]byte) {
+	w.queue.Lock()
+	defer w.queue.Unlock()
+	// the replaying may have caught up before the records are appended
+	atomic.StoreInt32(&w.healthy, 0)
+	for _, record := range records {
+		if err := w.queue.appendLocked(record); err != nil && w.errorPrint.Allow() {
+			_, _ = fmt.Fprintf(os.Stderr, "log spool writer appends error: %s\n", err)
+		}
+	}
+}
+
+func (w *SpoolWriter) appendRecord(record []byte) error {
+	err := w.queue.append(record)
+	if err != nil && w.errorPrint.Allow() {
+		_, _ = fmt.Fprintf(os.Stderr, "log spool writer appends error: %s\n", err)
+	}
+	return err
+}
+
+func (w *SpoolWriter) notifyReplayer() {
+	select {
+	case w.spooled <- struct{}{}:
+	default:
+	}
+}
+
+func (w *SpoolWriter) runReplayer() {
+	defer w.background.Done()
+	ticker := osTime.NewTicker(w.retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.spooled:
+		case <-ticker.C:
+		}
+		w.replay()
+	}
+}
+
+// replay writes the spooled logs in order until the spool is empty or the writer fails.
+func (w *SpoolWriter) replay() {
+	if w.queue.empty() {
+		return
+	}
+	if w.healthCheck != nil && w.healthCheck() != nil {
+		return
+	}
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+		w.queue.Lock()
+		data, pos, err := w.queue.peekLocked()
+		if err == io.EOF {
+			// the spool is caught up, the following logs are written directly.
+			atomic.StoreInt32(&w.healthy, 1)
+			w.queue.Unlock()
+			return
+		}
+		w.queue.Unlock()
+		if err != nil {
+			if w.errorPrint.Allow() {
+				_, _ = fmt.Fprintf(os.Stderr, "log spool writer reads error: %s\n", err)
+			}
+			w.queue.skip(pos)
+			continue
+		}
+		log, err := decodeSpoolRecord(data)
+		if err != nil {
+			w.queue.skip(pos)
+			continue
+		}
+		if err := w.LogWriter.Write(log); err != nil {
+			return
+		}
+		w.queue.commit(pos, data)
+	}
+}
+
+// encodeSpoolRecord encodes the log like AgentWriter does, and keeps the rendered content.
+func encodeSpoolRecord(buf []byte, log StructuredLog) []byte {
+	buf = EncodeKeyValueText(buf, spoolContentKey, SliceByteToString(log.GetContent()))
+	return encodeAgentRecord(buf, log)
+}
+
+func decodeSpoolRecord(data []byte) (*spooledLog, error) {
+	record, err := decodeAgentRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	log := &spooledLog{record: record, ctx: context.Background()}
+	for i, kv := range record.KVs {
+		if kv.Key == spoolContentKey {
+			log.content = kv.Value
+			record.KVs = append(record.KVs[:i], record.KVs[i+1:]...)
+			break
+		}
+	}
+	if record.LogID != "-" {
+		log.ctx = context.WithValue(log.ctx, ContextLogIDKey, record.LogID)
+	}
+	if record.SpanID != 0 {
+		log.ctx = context.WithValue(log.ctx, ContextSpanIDKey, record.SpanID)
+	}
+	return log, nil
+}
+
+// retainedLog recycles the log after both the writer and the SpoolWriter recycle it,
+// so the log could still be spooled after the writer fails.
+type retainedLog struct {
+	RecyclableLog
+	refs int32
+}
+
+var retainedLogPool = sync.Pool{
+	New: func() interface{} {
+		return &retainedLog{}
+	},
+}
+
+func retainLog(log RecyclableLog) *retainedLog {
+	l := retainedLogPool.Get().(*retainedLog)
+	l.RecyclableLog = log
+	l.refs = 2
+	return l
+}
+
+func (l *retainedLog) Recycle() {
+	if atomic.AddInt32(&l.refs, -1) != 0 {
+		return
+	}
+	log := l.RecyclableLog
+	l.RecyclableLog = nil
+	retainedLogPool.Put(l)
+	log.Recycle()
+}
+
+// spooledLog is a log replayed from the spool.
+type spooledLog struct {
+	record  *AgentRecord
+	content []byte
+	ctx     context.Context
+}
+
+func (l *spooledLog) Recycle()                    {}
+func (l *spooledLog) GetContent() []byte          { return l.content }
+func (l *spooledLog) GetBody() []byte             { return []byte(l.record.Message) }
+func (l *spooledLog) GetTime() osTime.Time        { return l.record.Time }
+func (l *spooledLog) GetLine() string             { return l.record.Location }
+func (l *spooledLog) GetLevel() string            { return l.record.Level }
+func (l *spooledLog) GetContext() context.Context { return l.ctx }
+func (l *spooledLog) GetLocation() []byte         { return []byte(l.record.Location) }
+func (l *spooledLog) GetPSM() string              { return l.record.PSM }
+func (l *spooledLog) GetKVList() []*KeyValue      { return l.record.KVs }
+func (l *spooledLog) GetKVListStr() []string {
+	res := make([]string, len(l.record.KVs)*2)
+	for i, kv := range l.record.KVs {
+		res[2*i], res[2*i+1] = kv.ToKV()
+	}
+	return res
+}
+
+type SpoolOption func(*SpoolWriter)
+
+// SetSpoolSegmentSize sets the size of each spool segment file, the default is 4MB.
+func SetSpoolSegmentSize(size int64) SpoolOption {
+	return func(writer *SpoolWriter) {
+		if size > 0 {
+			writer.segmentSize = size
+		}
+	}
+}
+
+// SetSpoolMaxDiskSize sets the max disk usage of the spool, the oldest segments are dropped if it exceeds,
+// the default is 256MB.
+func SetSpoolMaxDiskSize(size int64) SpoolOption {
+	return func(writer *SpoolWriter) {
+		writer.maxDiskSize = size
+	}
+}
+
+// SetSpoolChanSize sets the count of logs could be buffered in memory, the logs overflowed are spooled.
+func SetSpoolChanSize(size int) SpoolOption {
+	return func(writer *SpoolWriter) {
+		if size >= 0 {
+			writer.chanSize = size
+		}
+	}
+}
+
+// SetSpoolRetryInterval sets the interval to retry replaying after the writer fails, the default is 1s.
+func SetSpoolRetryInterval(interval osTime.Duration) SpoolOption {
+	return func(writer *SpoolWriter) {
+		if interval > 0 {
+			writer.retryInterval = interval
+		}
+	}
+}
+
+// SetSpoolHealthCheck sets a probe of the writer, the replaying is skipped if it returns an error.
+func SetSpoolHealthCheck(check func() error) SpoolOption {
+	return func(writer *SpoolWriter) {
+		writer.healthCheck = check
+	}
+}
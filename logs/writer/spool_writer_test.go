@@ -0,0 +1,282 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyWriter fails the writing if it is down.
+type flakyWriter struct {
+	sync.Mutex
+	down    int32
+	logs    []string
+	logIDs  []string
+	content []string
+	kvs     [][]string
+}
+
+func (w *flakyWriter) Write(log RecyclableLog) error {
+	defer log.Recycle()
+	if atomic.LoadInt32(&w.down) == 1 {
+		return errors.New("sink is down")
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.logs = append(w.logs, string(log.GetBody()))
+	w.logIDs = append(w.logIDs, logIDFromContext(log.GetContext()))
+	w.content = append(w.content, string(log.GetContent()))
+	w.kvs = append(w.kvs, log.GetKVListStr())
+	return nil
+}
+
+func (w *flakyWriter) received() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.logs...)
+}
+
+func (w *flakyWriter) Close() error { return nil }
+func (w *flakyWriter) Flush() error { return nil }
+
+func writeSpoolLogs(t *testing.T, w LogWriter, from, to int) {
+	for i := from; i < to; i++ {
+		log := newTestLog("Info", strconv.Itoa(i), NewOmniKeyValue("i", i))
+		log.ctx = context.WithValue(context.Background(), ContextLogIDKey, "logid-"+strconv.Itoa(i))
+		assert.Nil(t, w.Write(log))
+	}
+}
+
+func expectedSpoolLogs(from, to int) []string {
+	res := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		res = append(res, strconv.Itoa(i))
+	}
+	return res
+}
+
+func TestSpoolWriter_Replay(t *testing.T) {
+	fw := &flakyWriter{}
+	w := NewSpoolWriter(fw, t.TempDir(), SetSpoolRetryInterval(10*osTime.Millisecond))
+	writeSpoolLogs(t, w, 0, 5)
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, expectedSpoolLogs(0, 5), fw.received())
+
+	atomic.StoreInt32(&fw.down, 1)
+	writeSpoolLogs(t, w, 5, 100)
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, expectedSpoolLogs(0, 5), fw.received())
+
+	atomic.StoreInt32(&fw.down, 0)
+	assert.Eventually(t, func() bool { return len(fw.received()) == 100 }, 5*osTime.Second, 10*osTime.Millisecond)
+	// the live logs are written directly after the replaying catches up.
+	writeSpoolLogs(t, w, 100, 110)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, expectedSpoolLogs(0, 110), fw.logs)
+
+	// the replayed logs keep the content, context and kvs.
+	assert.Equal(t, "Info 50", fw.content[50])
+	assert.Equal(t, "logid-50", fw.logIDs[50])
+	assert.Equal(t, []string{"i", "50"}, fw.kvs[50])
+}
+
+func TestSpoolWriter_Restart(t *testing.T) {
+	dir := t.TempDir()
+	fw := &flakyWriter{down: 1}
+	w := NewSpoolWriter(fw, dir, SetSpoolSegmentSize(1024))
+	writeSpoolLogs(t, w, 0, 50)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 0, len(fw.logs))
+
+	// the spooled logs are replayed after restart
+	fw = &flakyWriter{}
+	w = NewSpoolWriter(fw, dir, SetSpoolSegmentSize(1024), SetSpoolRetryInterval(10*osTime.Millisecond))
+	assert.Eventually(t, func() bool { return len(fw.received()) == 50 }, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, expectedSpoolLogs(0, 50), fw.logs)
+
+	// nothing is replayed twice
+	fw = &flakyWriter{}
+	w = NewSpoolWriter(fw, dir, SetSpoolSegmentSize(1024), SetSpoolRetryInterval(10*osTime.Millisecond))
+	writeSpoolLogs(t, w, 50, 51)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, expectedSpoolLogs(50, 51), fw.logs)
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	assert.Equal(t, 1, len(segments))
+}
+
+func TestSpoolWriter_MaxDiskSize(t *testing.T) {
+	dir := t.TempDir()
+	fw := &flakyWriter{down: 1}
+	w := NewSpoolWriter(fw, dir, SetSpoolSegmentSize(1024), SetSpoolMaxDiskSize(4096), SetSpoolRetryInterval(10*osTime.Millisecond))
+	writeSpoolLogs(t, w, 0, 500)
+	assert.Nil(t, w.Flush())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	var total int64
+	for _, s := range segments {
+		info, err := os.Stat(s)
+		assert.Nil(t, err)
+		total += info.Size()
+	}
+	assert.LessOrEqual(t, total, int64(4096))
+
+	// the newest logs are replayed in order
+	atomic.StoreInt32(&fw.down, 0)
+	assert.Eventually(t, func() bool {
+		logs := fw.received()
+		return len(logs) > 0 && logs[len(logs)-1] == "499"
+	}, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	assert.Less(t, len(fw.logs), 500)
+	// the first log may be in writing when its segment is dropped
+	first, _ := strconv.Atoi(fw.logs[1])
+	assert.Equal(t, expectedSpoolLogs(first, 500), fw.logs[1:])
+}
+
+// gatedWriter blocks the first write after it is up until it is released.
+type gatedWriter struct {
+	flakyWriter
+	once    sync.Once
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (w *gatedWriter) Write(log RecyclableLog) error {
+	if atomic.LoadInt32(&w.down) == 0 {
+		w.once.Do(func() {
+			close(w.blocked)
+			<-w.release
+		})
+	}
+	return w.flakyWriter.Write(log)
+}
+
+// countSpoolRecords counts the records in the segments of the spool directory.
+func countSpoolRecords(t *testing.T, dir string) int {
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	count := 0
+	for _, s := range segments {
+		data, err := os.ReadFile(s)
+		assert.Nil(t, err)
+		for len(data) >= spoolRecordHeaderSize {
+			length, _ := DecodeUint32(data[:4])
+			data = data[spoolRecordHeaderSize+int(length):]
+			count++
+		}
+	}
+	return count
+}
+
+func TestSpoolWriter_MaxDiskSizeWhileReplaying(t *testing.T) {
+	dir := t.TempDir()
+	gw := &gatedWriter{blocked: make(chan struct{}), release: make(chan struct{})}
+	gw.down = 1
+	w := NewSpoolWriter(gw, dir, SetSpoolSegmentSize(1024), SetSpoolMaxDiskSize(4096), SetSpoolRetryInterval(10*osTime.Millisecond))
+	writeSpoolLogs(t, w, 0, 10)
+	assert.Nil(t, w.Flush())
+
+	// the replaying is blocked in writing log 0, while the spool exceeds the max size and drops the segment of log 0
+	atomic.StoreInt32(&gw.down, 0)
+	<-gw.blocked
+	writeSpoolLogs(t, w, 10, 500)
+	assert.Nil(t, w.Flush())
+	_, err := os.Stat(filepath.Join(dir, "00000000000000000001"+spoolSegmentSuffix))
+	assert.True(t, os.IsNotExist(err))
+	spooled := countSpoolRecords(t, dir)
+
+	// the rest of the spool is replayed without loss
+	close(gw.release)
+	assert.Eventually(t, func() bool {
+		logs := gw.received()
+		return len(logs) > 0 && logs[len(logs)-1] == "499"
+	}, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, "0", gw.logs[0])
+	assert.Equal(t, spooled, len(gw.logs)-1)
+	first, _ := strconv.Atoi(gw.logs[1])
+	assert.Equal(t, expectedSpoolLogs(first, 500), gw.logs[1:])
+}
+
+func TestSpoolWriter_Overflow(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewSpoolWriter(bw, t.TempDir(), SetSpoolChanSize(1))
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, w.Write(newTestLog("Info", strconv.Itoa(i))))
+	}
+	close(bw.release)
+	assert.Eventually(t, func() bool {
+		bw.Lock()
+		defer bw.Unlock()
+		return len(bw.bodies) == 10
+	}, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, expectedSpoolLogs(0, 10), bw.bodies)
+}
+
+func TestSpoolQueue_Corruption(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openSpoolQueue(dir, 1024, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, q.append([]byte("first")))
+	assert.Nil(t, q.append([]byte("second")))
+	assert.Nil(t, q.close())
+
+	// a partial record left by a crash is truncated
+	name := filepath.Join(dir, "00000000000000000001"+spoolSegmentSuffix)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, _ = f.Write([]byte{100, 0, 0, 0, 1, 2})
+	assert.Nil(t, f.Close())
+
+	q, err = openSpoolQueue(dir, 1024, 0)
+	assert.Nil(t, err)
+	data, pos, err := q.peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(data))
+	q.commit(pos, data)
+	data, pos, err = q.peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(data))
+	q.commit(pos, data)
+	_, _, err = q.peek()
+	assert.NotNil(t, err)
+	assert.True(t, q.empty())
+	assert.Nil(t, q.close())
+}
+
+// slowWriter writes slowly and records whether it is written concurrently.
+type slowWriter struct {
+	flakyWriter
+	writing    int32
+	concurrent int32
+}
+
+func (w *slowWriter) Write(log RecyclableLog) error {
+	if atomic.AddInt32(&w.writing, 1) > 1 {
+		atomic.StoreInt32(&w.concurrent, 1)
+	}
+	defer atomic.AddInt32(&w.writing, -1)
+	osTime.Sleep(100 * osTime.Microsecond)
+	return w.flakyWriter.Write(log)
+}
+
+func TestSpoolWriter_OverflowOrder(t *testing.T) {
+	sw := &slowWriter{}
+	w := NewSpoolWriter(sw, t.TempDir(), SetSpoolChanSize(4), SetSpoolRetryInterval(10*osTime.Millisecond))
+	writeSpoolLogs(t, w, 0, 500)
+	assert.Eventually(t, func() bool { return len(sw.received()) == 500 }, 5*osTime.Second, 10*osTime.Millisecond)
+	writeSpoolLogs(t, w, 500, 510)
+	assert.Eventually(t, func() bool { return len(sw.received()) == 510 }, 5*osTime.Second, 10*osTime.Millisecond)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, expectedSpoolLogs(0, 510), sw.logs)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&sw.concurrent))
+}
@@ -0,0 +1,383 @@
+package writer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	osTime "time"
+)
+
+// SyslogFormat is the message format of SyslogWriter.
+type SyslogFormat int
+
+const (
+	RFC5424 SyslogFormat = iota
+	RFC3164
+)
+
+// SyslogFacility is the facility of the messages.
+type SyslogFacility int
+
+const (
+	FacilityKern SyslogFacility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFtp
+)
+
+const (
+	FacilityLocal0 SyslogFacility = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// syslog severities
+const (
+	severityEmerg = iota
+	severityAlert
+	severityCrit
+	severityErr
+	severityWarning
+	severityNotice
+	severityInfo
+	severityDebug
+)
+
+var syslogSeverities = map[string]int{
+	"Trace":  severityDebug,
+	"Debug":  severityDebug,
+	"Info":   severityInfo,
+	"Notice": severityNotice,
+	"Warn":   severityWarning,
+	"Error":  severityErr,
+	"Fatal":  severityCrit,
+}
+
+const (
+	syslogTimeLayout5424 = "2006-01-02T15:04:05.000000Z07:00"
+	syslogTimeLayout3164 = "Jan _2 15:04:05"
+	// syslogSDID uses the example private enterprise number of RFC 5424.
+	syslogSDID          = "clib@32473"
+	syslogMaxAppNameLen = 48
+	syslogMaxSDNameLen  = 32
+	syslogDialTimeout   = osTime.Second
+	syslogWriteTimeout  = osTime.Second
+	syslogMaxBackoff    = 10 * osTime.Second
+)
+
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var errSyslogUnavailable = errors.New("syslog is unavailable")
+
+// SyslogWriter sends the logs to syslog, the KV list is put into the RFC 5424 structured data,
+// or appended to the message in RFC 3164:
+//
+//	<134>1 2021-07-15T15:19:14.161000+08:00 host p.s.m 1234 - [clib@32473 location="main.go:26" logid="1111" count="100"] hello
+//
+// It supports the local syslog socket, unix, UDP and TCP, the octet-counted framing is used by TCP.
+// The connection is created by the first log, and it reconnects after failures.
+type SyslogWriter struct {
+	network  string
+	addr     string
+	format   SyslogFormat
+	facility SyslogFacility
+	appName  string
+	hostname string
+	pid      string
+
+	lock     sync.Mutex
+	conn     net.Conn
+	connNet  string
+	nextDial osTime.Time
+	backoff  osTime.Duration
+}
+
+// NewSyslogWriter creates a SyslogWriter, it writes to the local syslog socket in RFC 5424 by default,
+// please use SetSyslogNetwork to send to a remote server, and SetSyslogFormat(RFC3164) for the servers only accepting it.
+func NewSyslogWriter(options ...SyslogOption) LogWriter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &SyslogWriter{
+		format:   RFC5424,
+		facility: FacilityUser,
+		hostname: hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+	for _, op := range options {
+		op(w)
+	}
+	return w
+}
+
+func (w *SyslogWriter) Write(log RecyclableLog) error {
+	defer log.Recycle()
+	packet := NewPacket(0)
+	defer PutPacket(packet)
+	*packet = w.encode(*packet, log)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// retry once with a new connection since the server may be restarted.
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = w.connect(); err != nil {
+			return err
+		}
+		_ = w.conn.SetWriteDeadline(osTime.Now().Add(syslogWriteTimeout))
+		if err = w.send(*packet); err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *SyslogWriter) Flush() error {
+	return nil
+}
+
+func (w *SyslogWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// connect dials the server if it is not connected, it backs off exponentially after failures.
+func (w *SyslogWriter) connect() error {
+	if w.conn != nil {
+		return nil
+	}
+	now := osTime.Now()
+	if now.Before(w.nextDial) {
+		return errSyslogUnavailable
+	}
+	conn, network, err := w.dial()
+	if err != nil {
+		if w.backoff == 0 {
+			w.backoff = 100 * osTime.Millisecond
+		} else if w.backoff *= 2; w.backoff > syslogMaxBackoff {
+			w.backoff = syslogMaxBackoff
+		}
+		w.nextDial = now.Add(w.backoff)
+		return err
+	}
+	w.conn, w.connNet = conn, network
+	w.backoff = 0
+	return nil
+}
+
+func (w *SyslogWriter) dial() (net.Conn, string, error) {
+	if w.network != "" {
+		conn, err := net.DialTimeout(w.network, w.addr, syslogDialTimeout)
+		return conn, w.network, err
+	}
+	for _, path := range localSyslogPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, path, syslogDialTimeout)
+			if err == nil {
+				return conn, network, nil
+			}
+		}
+	}
+	return nil, "", errSyslogUnavailable
+}
+
+// send writes the message with the framing of the transport.
+func (w *SyslogWriter) send(msg []byte) error {
+	var err error
+	switch w.connNet {
+	case "tcp", "tcp4", "tcp6":
+		// octet counting framing, RFC 6587
+		header := strconv.AppendInt(make([]byte, 0, 8), int64(len(msg)), 10)
+		header = append(header, ' ')
+		_, err = (&net.Buffers{header, msg}).WriteTo(w.conn)
+	case "unix":
+		// stream socket, messages are separated by the line break.
+		_, err = (&net.Buffers{msg, []byte{'\n'}}).WriteTo(w.conn)
+	default:
+		_, err = w.conn.Write(msg)
+	}
+	return err
+}
+
+func (w *SyslogWriter) encode(buf []byte, log StructuredLog) []byte {
+	severity, ok := syslogSeverities[log.GetLevel()]
+	if !ok {
+		severity = severityInfo
+	}
+	appName := w.appName
+	if appName == "" {
+		appName = log.GetPSM()
+	}
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(int(w.facility)*8+severity), 10)
+	buf = append(buf, '>')
+	if w.format == RFC3164 {
+		return w.encode3164(buf, appName, log)
+	}
+	return w.encode5424(buf, appName, log)
+}
+
+// encode5424 encodes the message after PRI in RFC 5424.
+func (w *SyslogWriter) encode5424(buf []byte, appName string, log StructuredLog) []byte {
+	buf = append(buf, "1 "...)
+	buf = log.GetTime().AppendFormat(buf, syslogTimeLayout5424)
+	buf = append(buf, ' ')
+	buf = appendSyslogName(buf, w.hostname, 255)
+	buf = append(buf, ' ')
+	buf = appendSyslogName(buf, appName, syslogMaxAppNameLen)
+	buf = append(buf, ' ')
+	buf = append(buf, w.pid...)
+	buf = append(buf, " - ["...)
+	buf = append(buf, syslogSDID...)
+	buf = appendSyslogParam(buf, "location", SliceByteToString(log.GetLocation()))
+	buf = appendSyslogFields(buf, log)
+	buf = append(buf, "] "...)
+	return append(buf, log.GetBody()...)
+}
+
+// encode3164 encodes the message after PRI in RFC 3164, which has no structured data,
+// so the logid, spanid and KV list are appended to the message in the same form as the RFC 5424 SD-PARAMs:
+//
+//	<14>Jul 15 15:19:14 host p.s.m[1234]: main.go:26 hello logid="1111" count="100"
+func (w *SyslogWriter) encode3164(buf []byte, appName string, log StructuredLog) []byte {
+	buf = log.GetTime().AppendFormat(buf, syslogTimeLayout3164)
+	buf = append(buf, ' ')
+	buf = appendSyslogName(buf, w.hostname, 255)
+	buf = append(buf, ' ')
+	buf = appendSyslogName(buf, appName, syslogMaxAppNameLen)
+	buf = append(buf, '[')
+	buf = append(buf, w.pid...)
+	buf = append(buf, "]: "...)
+	buf = append(buf, log.GetLocation()...)
+	buf = append(buf, ' ')
+	buf = append(buf, log.GetBody()...)
+	return appendSyslogFields(buf, log)
+}
+
+// appendSyslogFields appends the logid, spanid and KV list of the log as SD-PARAMs.
+func appendSyslogFields(buf []byte, log StructuredLog) []byte {
+	if logID := logIDFromContext(log.GetContext()); logID != "-" {
+		buf = appendSyslogParam(buf, "logid", logID)
+	}
+	if spanID := spanIDFromContext(log.GetContext()); spanID != 0 {
+		buf = append(buf, " spanid=\""...)
+		buf = strconv.AppendUint(buf, spanID, 10)
+		buf = append(buf, '"')
+	}
+	packet := NewPacket(0)
+	defer PutPacket(packet)
+	for _, kv := range log.GetKVList() {
+		*packet = kv.AppendValueStr((*packet)[:0])
+		buf = appendSyslogParam(buf, kv.Key, SliceByteToString(*packet))
+	}
+	return buf
+}
+
+// appendSyslogName appends a header field which only contains printable ASCII, "-" is used if it is empty.
+func appendSyslogName(buf []byte, name string, maxLen int) []byte {
+	if name == "" {
+		return append(buf, '-')
+	}
+	if len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// appendSyslogParam appends a SD-PARAM, invalid characters in the name are replaced with '_',
+// '"', '\' and ']' in the value are escaped.
+func appendSyslogParam(buf []byte, name, value string) []byte {
+	buf = append(buf, ' ')
+	if name == "" {
+		buf = append(buf, '_')
+	}
+	if len(name) > syslogMaxSDNameLen {
+		name = name[:syslogMaxSDNameLen]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	buf = append(buf, '=', '"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c == ']' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, c)
+	}
+	return append(buf, '"')
+}
+
+type SyslogOption func(*SyslogWriter)
+
+// SetSyslogNetwork sets the transport of the server, network could be "unix", "unixgram", "udp" or "tcp",
+// e.g. SetSyslogNetwork("tcp", "127.0.0.1:514").
+func SetSyslogNetwork(network, addr string) SyslogOption {
+	return func(writer *SyslogWriter) {
+		writer.network = network
+		writer.addr = addr
+	}
+}
+
+// SetSyslogFormat sets the message format, RFC 5424 by default which puts the KV list into structured data.
+func SetSyslogFormat(format SyslogFormat) SyslogOption {
+	return func(writer *SyslogWriter) {
+		writer.format = format
+	}
+}
+
+// SetSyslogFacility sets the facility of messages, the default is FacilityUser.
+func SetSyslogFacility(facility SyslogFacility) SyslogOption {
+	return func(writer *SyslogWriter) {
+		writer.facility = facility
+	}
+}
+
+// SetSyslogAppName sets the app name of messages, the PSM of the log is used by default.
+func SetSyslogAppName(appName string) SyslogOption {
+	return func(writer *SyslogWriter) {
+		writer.appName = appName
+	}
+}
+
+// SetSyslogHostname sets the hostname of messages, the default is os.Hostname().
+func SetSyslogHostname(hostname string) SyslogOption {
+	return func(writer *SyslogWriter) {
+		writer.hostname = hostname
+	}
+}
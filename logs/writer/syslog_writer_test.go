@@ -0,0 +1,126 @@
+package writer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	osTime "time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSyslogTestLog(level string) *testLog {
+	log := newTestLog(level, "hello", NewOmniKeyValue("count", 100), NewOmniKeyValue("a b", "x\"]"))
+	log.time = osTime.Date(2021, 7, 15, 15, 19, 14, 161000000, osTime.UTC)
+	log.ctx = context.WithValue(context.Background(), ContextLogIDKey, "1111")
+	return log
+}
+
+func TestSyslogWriter_UDP5424(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// RFC 5424 is the default format
+	w := NewSyslogWriter(SetSyslogNetwork("udp", conn.LocalAddr().String()), SetSyslogHostname("host"))
+	log := newSyslogTestLog("Warn")
+	assert.Nil(t, w.Write(log))
+	assert.Equal(t, 1, log.recycled)
+	assert.Nil(t, w.Close())
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(osTime.Now().Add(5 * osTime.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	expected := "<12>1 2021-07-15T15:19:14.161000Z host test.psm " + strconv.Itoa(os.Getpid()) +
+		` - [clib@32473 location="write_test.go:42" logid="1111" count="100" a_b="x\"\]"] hello`
+	assert.Equal(t, expected, string(buf[:n]))
+}
+
+func TestSyslogWriter_TCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	msgs := make(chan string, 100)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				reader := bufio.NewReader(conn)
+				for {
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(length))
+					msg := make([]byte, n)
+					if _, err := io.ReadFull(reader, msg); err != nil {
+						return
+					}
+					msgs <- string(msg)
+				}
+			}()
+		}
+	}()
+
+	w := NewSyslogWriter(SetSyslogNetwork("tcp", listener.Addr().String()), SetSyslogFormat(RFC5424),
+		SetSyslogFacility(FacilityLocal0), SetSyslogAppName("app"))
+	defer w.Close()
+	assert.Nil(t, w.Write(newSyslogTestLog("Error")))
+	msg := <-msgs
+	assert.True(t, strings.HasPrefix(msg, "<131>1 2021-07-15T15:19:14.161000Z "), msg)
+	assert.Contains(t, msg, " app ")
+	assert.True(t, strings.HasSuffix(msg, "] hello"), msg)
+
+	// the server closes the connection, the writer reconnects.
+	(<-conns).Close()
+	assert.Eventually(t, func() bool {
+		_ = w.Write(newSyslogTestLog("Info"))
+		select {
+		case msg := <-msgs:
+			return strings.HasPrefix(msg, "<134>1 ")
+		default:
+			return false
+		}
+	}, 5*osTime.Second, 10*osTime.Millisecond)
+}
+
+func TestSyslogWriter_Unix3164(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "syslog.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	w := NewSyslogWriter(SetSyslogNetwork("unix", socketPath), SetSyslogFormat(RFC3164), SetSyslogHostname("host"),
+		SetSyslogFacility(FacilityDaemon))
+	assert.Nil(t, w.Write(newSyslogTestLog("Trace")))
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "<31>Jul 15 15:19:14 host test.psm["+strconv.Itoa(os.Getpid())+`]: write_test.go:42 hello logid="1111" count="100" a_b="x\"\]"`+"\n", line)
+	assert.Nil(t, w.Close())
+}
+
+func TestSyslogWriter_Unavailable(t *testing.T) {
+	w := NewSyslogWriter(SetSyslogNetwork("unix", filepath.Join(t.TempDir(), "none.sock")))
+	log := newSyslogTestLog("Info")
+	assert.NotNil(t, w.Write(log))
+	assert.Equal(t, 1, log.recycled)
+	// it does not dial again in the backoff.
+	assert.Equal(t, errSyslogUnavailable, w.Write(newSyslogTestLog("Info")))
+	assert.Nil(t, w.Close())
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -34,6 +35,7 @@ func newSyncWriter(w io.Writer) *syncWriter {
 type rotatedFile struct {
 	sync.WaitGroup
 	w    *syncWriter
+	file io.WriteCloser
 	done chan bool
 }
 
@@ -41,6 +43,7 @@ func newRotatedFile(file io.WriteCloser) *rotatedFile {
 	f := &rotatedFile{
 		sync.WaitGroup{},
 		newSyncWriter(file),
+		file,
 		make(chan bool),
 	}
 	f.Add(1)
@@ -67,13 +70,19 @@ func newRotatedFile(file io.WriteCloser) *rotatedFile {
 func (f *rotatedFile) Close() error {
 	f.done <- true
 	f.Wait()
-	return nil
+	f.w.Lock()
+	defer f.w.Unlock()
+	return f.file.Close()
 }
 
+// Rotate flushes the buffered logs to the previous file and closes it,
+// the following logs are written to w.
 func (f *rotatedFile) Rotate(w io.WriteCloser) {
 	f.w.Lock()
 	defer f.w.Unlock()
 	_ = f.w.Flush()
+	_ = f.file.Close()
+	f.file = w
 	f.w.Reset(w)
 }
 
@@ -105,36 +114,62 @@ func (f *rotatedFile) Write(c []byte) (int, error) {
 }
 
 func logIDFromContext(ctx context.Context) string {
-	if ctx == nil {
-		return "-"
-	}
-	val := ctx.Value(ContextLogIDKey)
-	if val != nil {
-		logID := val.(string)
+	if logID := ExtractContext(ctx).LogID; logID != "" {
 		return logID
 	}
 	return "-"
 }
 
 func spanIDFromContext(ctx context.Context) uint64 {
-	if ctx == nil {
-		return 0
+	return ExtractContext(ctx).SpanID
+}
+
+// getFileDate get date from log file suffix, log file name format: program_name.log.2023-08-23_07,
+// the size rotated segments look like program_name.log.2023-08-23_07.1
+func getFileDate(name string) osTime.Time {
+	sn := strings.Split(trimCompressionExt(name), ".")
+	suffix := sn[len(sn)-1]
+	if _, err := strconv.Atoi(suffix); err == nil && len(sn) > 1 {
+		suffix = sn[len(sn)-2]
+	}
+	t, _ := osTime.Parse(LogFileSuffixDateFormat, suffix)
+	return t
+}
+
+// isSegmentFile reports whether the file is a rotated segment of the log file, like "app.log.2023-08-23_07",
+// "app.log.2023-08-23_07.1" or "app.log.2023-08-23_07.1.gz", but not "app.log.wf" or "app.log.bak".
+func isSegmentFile(logName, name string) bool {
+	if !strings.HasPrefix(name, logName+".") {
+		return false
 	}
-	val := ctx.Value(ContextSpanIDKey)
-	if val != nil {
-		spanID, valid := val.(uint64)
-		if valid {
-			return spanID
+	sn := strings.Split(trimCompressionExt(name[len(logName)+1:]), ".")
+	if len(sn) > 2 {
+		return false
+	}
+	if _, err := osTime.Parse(LogFileSuffixDateFormat, sn[0]); err != nil {
+		return false
+	}
+	if len(sn) == 2 {
+		if sn[1] == "" {
+			return false
+		}
+		for _, c := range sn[1] {
+			if c < '0' || c > '9' {
+				return false
+			}
 		}
 	}
-	return 0
+	return true
 }
 
-// getFileDate get date from log file suffix, log file name format: program_name.log.2023-08-23_07
-func getFileDate(name string) osTime.Time {
-	sn := strings.Split(name, ".")
-	t, _ := osTime.Parse(LogFileSuffixDateFormat, sn[len(sn)-1])
-	return t
+// getFileSeq get the segment sequence from log file suffix, it returns 0 if the file has no sequence.
+func getFileSeq(name string) int {
+	sn := strings.Split(trimCompressionExt(name), ".")
+	seq, err := strconv.Atoi(sn[len(sn)-1])
+	if err != nil {
+		return 0
+	}
+	return seq
 }
 
 // The parameter is a string unsafely converted from byte slice
@@ -1,12 +1,56 @@
 package writer
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
 	osTime "time"
 )
 
+// testLog is a simple RecyclableLog used in writer tests.
+type testLog struct {
+	content  []byte
+	body     []byte
+	level    string
+	location []byte
+	psm      string
+	ctx      context.Context
+	time     osTime.Time
+	kvs      []*KeyValue
+	recycled int
+}
+
+func newTestLog(level, body string, kvs ...*KeyValue) *testLog {
+	return &testLog{
+		content:  []byte(level + " " + body),
+		body:     []byte(body),
+		level:    level,
+		location: []byte("write_test.go:42"),
+		psm:      "test.psm",
+		time:     osTime.Now(),
+		kvs:      kvs,
+	}
+}
+
+func (l *testLog) Recycle()                    { l.recycled++ }
+func (l *testLog) GetContent() []byte          { return l.content }
+func (l *testLog) GetBody() []byte             { return l.body }
+func (l *testLog) GetTime() osTime.Time        { return l.time }
+func (l *testLog) GetLine() string             { return string(l.location) }
+func (l *testLog) GetLevel() string            { return l.level }
+func (l *testLog) GetContext() context.Context { return l.ctx }
+func (l *testLog) GetLocation() []byte         { return l.location }
+func (l *testLog) GetPSM() string              { return l.psm }
+func (l *testLog) GetKVList() []*KeyValue      { return l.kvs }
+func (l *testLog) GetKVListStr() []string {
+	res := make([]string, len(l.kvs)*2)
+	for i, kv := range l.kvs {
+		res[2*i], res[2*i+1] = kv.ToKV()
+	}
+	return res
+}
+
 func TestRateMap(t *testing.T) {
 	rateBucketMap2 := NewRateLimiterMap()
 	{
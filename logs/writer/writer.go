@@ -14,6 +14,13 @@ type LogWriter interface {
 	Flush() error
 }
 
+// BatchWriter is an optional interface of LogWriter to write a batch of logs in one call,
+// AsyncWriter uses it to amortize the overheads like locks and syscalls.
+// Every log in the batch should be recycled after writing like Write does.
+type BatchWriter interface {
+	WriteBatch(logs []RecyclableLog) error
+}
+
 // RecyclableLog defines the log could be handled by writer,
 // every writer should call Recycle method after printing.
 type RecyclableLog interface {